@@ -0,0 +1,78 @@
+package completion
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var noDescriptions bool
+
+func NewCmdCompletion() *cobra.Command {
+	c := &cobra.Command{
+		Use:       "completion bash|zsh|fish|powershell",
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		Short:     "Output the shell completion script for the given shell",
+		Long: `Output the shell completion script for the given shell
+
+Besides commands and flags, cluster names, namespaces and the contexts written
+by tcli are completed, for example after "tcli login", "tcli inspect",
+"tcli use" and "-n". They are fetched from the supervisor using the session
+token in the kubeconfig, so log in first. Namespaces are only completed when
+the password is given by --password, --password-file, ~/.netrc or the credential
+store unlocked by TCLI_CREDENTIALS_PASSPHRASE. Completion never prompts, reads
+stdin or runs --password-command. Answers are cached like those of "tcli list".
+
+Examples:
+	# Bash, which requires the bash-completion package. Load the completions
+	# in the current shell
+	source <(tcli completion bash)
+
+	# or load them in every new shell, on Linux
+	tcli completion bash > /etc/bash_completion.d/tcli
+	# on macOS
+	tcli completion bash > $(brew --prefix)/etc/bash_completion.d/tcli
+
+	# Zsh. If completion isn't enabled already, enable it once with
+	echo "autoload -U compinit; compinit" >> ~/.zshrc
+	# and load the completions in every new shell
+	tcli completion zsh > "${fpath[1]}/_tcli"
+
+	# Fish. Load the completions in the current shell
+	tcli completion fish | source
+	# or in every new shell
+	tcli completion fish > ~/.config/fish/completions/tcli.fish
+
+	# PowerShell. Load the completions in the current shell
+	tcli completion powershell | Out-String | Invoke-Expression
+	# or add the output to your PowerShell profile to load them in every new shell
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(os.Stdout, !noDescriptions)
+			case "zsh":
+				if noDescriptions {
+					return root.GenZshCompletionNoDesc(os.Stdout)
+				}
+				return root.GenZshCompletion(os.Stdout)
+			case "fish":
+				return root.GenFishCompletion(os.Stdout, !noDescriptions)
+			case "powershell":
+				if noDescriptions {
+					return root.GenPowerShellCompletion(os.Stdout)
+				}
+				return root.GenPowerShellCompletionWithDesc(os.Stdout)
+			default:
+				return fmt.Errorf("unsupported shell %q", args[0])
+			}
+		},
+	}
+	c.Flags().BoolVar(&noDescriptions, "no-descriptions", false, "Don't include descriptions of the completions.")
+	return c
+}
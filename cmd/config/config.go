@@ -0,0 +1,197 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	tcliconfig "github.com/middlewaregruppen/tcli/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewCmdConfig() *cobra.Command {
+	var keys strings.Builder
+	for _, k := range tcliconfig.Keys {
+		fmt.Fprintf(&keys, "\t%-23s %s\n", k.Name, k.Description)
+	}
+
+	c := &cobra.Command{
+		Use:   "config",
+		Short: "Manage profiles in the tcli configuration file",
+		Long: `Manage profiles in the tcli configuration file
+
+Profiles are named sets of flag values stored in ~/.config/tcli/config.yaml.
+The profile given by --profile or TCLI_PROFILE, or else the current profile,
+provides the values of flags that aren't given on the command line or by a
+TCLI_* environment variable.
+
+Profiles support the following keys:
+` + keys.String() + `
+Examples:
+	# Create a profile for a lab supervisor
+	tcli config set server https://lab.supervisor.local --profile lab
+	tcli config set username bob --profile lab
+	tcli config set insecure true --profile lab
+
+	# Make it the current profile
+	tcli config use-profile lab
+
+	# Log in to a cluster using another profile
+	tcli login CLUSTER --profile prod-a
+
+	# Show the configuration file
+	tcli config view
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		// Profiles are managed here, so a missing profile must not be an
+		// error like it is for the other commands
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+	}
+	c.AddCommand(newCmdView())
+	c.AddCommand(newCmdGet())
+	c.AddCommand(newCmdSet())
+	c.AddCommand(newCmdUseProfile())
+	c.AddCommand(newCmdDeleteProfile())
+	return c
+}
+
+func newCmdView() *cobra.Command {
+	return &cobra.Command{
+		Use:   "view",
+		Args:  cobra.NoArgs,
+		Short: "Print the configuration file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, _, err := auth.LoadConfig()
+			if err != nil {
+				return err
+			}
+			b, err := conf.Marshal()
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(b)
+			return err
+		},
+	}
+}
+
+func newCmdGet() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get KEY",
+		Args:  cobra.ExactArgs(1),
+		Short: "Print a value of the selected profile",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, _, err := auth.LoadConfig()
+			if err != nil {
+				return err
+			}
+			name, err := selectedProfile(conf)
+			if err != nil {
+				return err
+			}
+			profile, err := conf.Profile(name)
+			if err != nil {
+				return err
+			}
+			value, ok := profile[args[0]]
+			if !ok {
+				return fmt.Errorf("%q is not set in profile %q", args[0], name)
+			}
+			fmt.Println(value)
+			return nil
+		},
+	}
+}
+
+func newCmdSet() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set KEY VALUE",
+		Args:  cobra.ExactArgs(2),
+		Short: "Set a value of the selected profile, creating the profile if needed",
+		Long: `Set a value of the selected profile, creating the profile if needed
+
+An empty value removes the key from the profile. The first profile created
+becomes the current profile.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, path, err := auth.LoadConfig()
+			if err != nil {
+				return err
+			}
+			name, err := selectedProfile(conf)
+			if err != nil {
+				return err
+			}
+			if err := conf.Set(name, args[0], args[1]); err != nil {
+				return err
+			}
+			if len(conf.CurrentProfile) == 0 {
+				conf.CurrentProfile = name
+			}
+			if err := conf.Save(path); err != nil {
+				return fmt.Errorf("writing %s: %w", path, err)
+			}
+			fmt.Printf("Set %s in profile %q\n", args[0], name)
+			return nil
+		},
+	}
+}
+
+func newCmdUseProfile() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use-profile NAME",
+		Args:  cobra.ExactArgs(1),
+		Short: "Make a profile the current profile",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, path, err := auth.LoadConfig()
+			if err != nil {
+				return err
+			}
+			if _, err := conf.Profile(args[0]); err != nil {
+				return err
+			}
+			conf.CurrentProfile = args[0]
+			if err := conf.Save(path); err != nil {
+				return fmt.Errorf("writing %s: %w", path, err)
+			}
+			fmt.Printf("Switched to profile %q\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newCmdDeleteProfile() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete-profile NAME",
+		Args:  cobra.ExactArgs(1),
+		Short: "Remove a profile",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, path, err := auth.LoadConfig()
+			if err != nil {
+				return err
+			}
+			if err := conf.DeleteProfile(args[0]); err != nil {
+				return err
+			}
+			if err := conf.Save(path); err != nil {
+				return fmt.Errorf("writing %s: %w", path, err)
+			}
+			fmt.Printf("Deleted profile %q\n", args[0])
+			return nil
+		},
+	}
+}
+
+// selectedProfile returns the name of the profile to operate on
+func selectedProfile(conf *tcliconfig.Config) (string, error) {
+	name := auth.SelectedProfile(conf)
+	if len(name) == 0 {
+		return "", errors.New("no profile selected, use --profile NAME or \"tcli config use-profile NAME\"")
+	}
+	return name, nil
+}
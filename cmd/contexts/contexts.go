@@ -0,0 +1,169 @@
+package contexts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+var output string
+
+// Kinds of managed contexts
+const (
+	kindSupervisor = "supervisor"
+	kindGuest      = "guest"
+)
+
+// Credential types of managed contexts
+const (
+	credentialToken = "token"
+	credentialExec  = "exec"
+)
+
+// contextInfo describes a context written by "tcli login"
+type contextInfo struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Server is the API server of the context cluster
+	Server string `json:"server"`
+	// Supervisor is the URL of the supervisor the context was logged in to
+	Supervisor string `json:"supervisor,omitempty"`
+	// Namespace is the supervisor namespace of the context
+	Namespace string `json:"namespace,omitempty"`
+	// Cluster is the name of the guest cluster
+	Cluster    string     `json:"cluster,omitempty"`
+	User       string     `json:"user"`
+	AuthInfo   string     `json:"authInfo"`
+	Credential string     `json:"credential"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	Expired    bool       `json:"expired"`
+	Current    bool       `json:"current"`
+}
+
+func NewCmdContexts() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "contexts",
+		Args:  cobra.NoArgs,
+		Short: "List the contexts written by tcli",
+		Long: `List the contexts written by tcli
+
+Only the contexts written by "tcli login" are listed, together with the kind
+of cluster, the supervisor namespace, the user whose token kubectl sends and
+when that token expires. The current context is marked with a *.
+
+Examples:
+	# List the contexts
+	tcli contexts
+
+	# Find out when the token of the current context expires
+	tcli contexts -o json | jq '.[] | select(.current) | .expiresAt'
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if output != "" && output != "json" {
+				return fmt.Errorf("unsupported output format %q, use json", output)
+			}
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := auth.LoadKubeconfig()
+			if err != nil {
+				return err
+			}
+
+			contexts := make([]contextInfo, 0)
+			for _, mc := range auth.ManagedContexts(conf) {
+				contexts = append(contexts, describe(mc, time.Now()))
+			}
+
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(contexts)
+			}
+			if len(contexts) == 0 {
+				fmt.Println("Not logged in. Please run 'tcli login' to authenticate")
+				return nil
+			}
+			return printContexts(contexts, time.Now())
+		},
+	}
+	c.Flags().StringVarP(&output, "output", "o", "", "Output format. One of: json.")
+	return c
+}
+
+// describe returns the information shown about a managed context
+func describe(mc auth.ManagedContext, now time.Time) contextInfo {
+	res := contextInfo{
+		Name:       mc.Name,
+		Kind:       kindGuest,
+		Server:     mc.Server,
+		Namespace:  mc.Namespace,
+		User:       mc.Username,
+		AuthInfo:   mc.Context.AuthInfo,
+		Credential: credentialToken,
+		Current:    mc.Current,
+	}
+	if mc.Supervisor {
+		res.Kind = kindSupervisor
+	}
+	if info, ok := mc.Info(); ok {
+		res.Supervisor = info.Server
+		res.Cluster = info.Cluster
+		if len(info.Cluster) > 0 {
+			res.Namespace = info.Namespace
+		}
+	}
+	if mc.AuthInfo != nil && mc.AuthInfo.Exec != nil {
+		res.Credential = credentialExec
+	}
+	if t, err := auth.ParseToken(auth.StoredToken(mc.AuthInfo)); err == nil && !t.ExpiresAt.IsZero() {
+		expiresAt := t.ExpiresAt
+		res.ExpiresAt = &expiresAt
+		res.Expired = t.Expired(now)
+	}
+	return res
+}
+
+func printContexts(contexts []contextInfo, now time.Time) error {
+	table := &v1.Table{
+		ColumnDefinitions: []v1.TableColumnDefinition{
+			{Name: "CURRENT", Type: "string"},
+			{Name: "NAME", Type: "string"},
+			{Name: "KIND", Type: "string"},
+			{Name: "SERVER", Type: "string"},
+			{Name: "NAMESPACE", Type: "string"},
+			{Name: "USER", Type: "string"},
+			{Name: "CREDENTIAL", Type: "string"},
+			{Name: "EXPIRES", Type: "string"},
+		},
+	}
+	for _, c := range contexts {
+		current := ""
+		if c.Current {
+			current = "*"
+		}
+		expires := "<unknown>"
+		switch {
+		case c.ExpiresAt == nil:
+		case c.Expired:
+			expires = fmt.Sprintf("expired %s ago", duration.HumanDuration(now.Sub(*c.ExpiresAt)))
+		default:
+			expires = fmt.Sprintf("%s (in %s)", c.ExpiresAt.Local().Format("2006-01-02 15:04"), duration.HumanDuration(c.ExpiresAt.Sub(now)))
+		}
+		table.Rows = append(table.Rows, v1.TableRow{
+			Cells: []interface{}{current, c.Name, c.Kind, c.Server, c.Namespace, c.User, c.Credential, expires},
+		})
+	}
+	printer := printers.NewTablePrinter(printers.PrintOptions{})
+	return printer.PrintObj(table, os.Stdout)
+}
@@ -0,0 +1,129 @@
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauthv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+)
+
+var (
+	tanzuCluster   string
+	tanzuNamespace string
+)
+
+func NewCmdCredential() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "credential",
+		Args:  cobra.NoArgs,
+		Short: "Print a session token in the kubectl ExecCredential format",
+		Long: `Print a session token in the kubectl ExecCredential format
+
+This command implements the client.authentication.k8s.io/v1 exec credential
+protocol and is not meant to be run by hand. Instead kubectl runs it to obtain
+a token whenever it needs one, when the kubeconfig was written with
+"tcli login --exec-credential". Tokens are cached until they expire, after
+which tcli logs in to the supervisor again. The password is resolved the same
+way as by "tcli login", and only prompted for if a terminal is available.
+
+Examples:
+	# Print a token for the supervisor
+	tcli credential -s SERVER -u USER
+
+	# Print a token for a Tanzu cluster
+	tcli credential -s SERVER -u USER --cluster CLUSTER -n NAMESPACE
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+			defer cancel()
+
+			tanzuServer := viper.GetString("server")
+			tanzuUsername := viper.GetString("username")
+
+			u, err := url.Parse(tanzuServer)
+			if err != nil {
+				return fmt.Errorf("parsing server URL: %w", err)
+			}
+			if len(u.Host) == 0 || len(tanzuUsername) == 0 {
+				return errors.New("both --server and --username are required")
+			}
+
+			token, err := auth.CachedToken(u.Host, tanzuUsername, tanzuNamespace, tanzuCluster)
+			if err != nil {
+				return err
+			}
+
+			if len(token) == 0 {
+				token, err = login(ctx, tanzuServer, tanzuUsername)
+				if err != nil {
+					return err
+				}
+				if err := auth.StoreToken(u.Host, tanzuUsername, tanzuNamespace, tanzuCluster, token); err != nil {
+					return err
+				}
+			}
+
+			cred := clientauthv1.ExecCredential{
+				TypeMeta: v1.TypeMeta{APIVersion: auth.ExecAPIVersion, Kind: "ExecCredential"},
+				Status:   &clientauthv1.ExecCredentialStatus{Token: token},
+			}
+			if info, err := auth.ParseToken(token); err == nil && !info.ExpiresAt.IsZero() {
+				expiry := v1.NewTime(info.ExpiresAt)
+				cred.Status.ExpirationTimestamp = &expiry
+			}
+			return json.NewEncoder(os.Stdout).Encode(cred)
+		},
+	}
+	c.Flags().StringVar(&tanzuCluster, "cluster", "", "Tanzu Kubernetes cluster to get a token for. Omit to get a supervisor token.")
+	c.Flags().StringVarP(&tanzuNamespace, "namespace", "n", "", "Namespace in which the Tanzu Kubernetes cluster resides.")
+	return c
+}
+
+// login authenticates with the supervisor and returns a new session token
+// for the supervisor or, if --cluster is set, for the guest cluster
+func login(ctx context.Context, server, username string) (string, error) {
+	password, err := auth.ResolvePassword(server, username, auth.Interactive)
+	if err != nil {
+		return "", fmt.Errorf("session expired: %w", err)
+	}
+
+	opts, err := auth.ClientOptions(server)
+	if err != nil {
+		return "", err
+	}
+	c, err := client.New(server, append(opts, client.WithCredentials(client.BasicCredentials(username, password)))...)
+	if err != nil {
+		return "", err
+	}
+
+	if len(tanzuCluster) == 0 {
+		sess, err := c.Login(ctx, username, password)
+		if err != nil {
+			return "", err
+		}
+		return sess.SessionID, nil
+	}
+
+	res, err := c.LoginCluster(ctx, tanzuCluster, tanzuNamespace)
+	if err != nil {
+		if errors.Is(err, client.ErrClusterNotFound) {
+			return "", fmt.Errorf("cluster %q not found", tanzuCluster)
+		}
+		return "", err
+	}
+	return res.SessionID, nil
+}
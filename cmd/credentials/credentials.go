@@ -0,0 +1,186 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/pkg/credstore"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+func NewCmdCredentials() *cobra.Command {
+	c := &cobra.Command{
+		Use:     "credentials",
+		Aliases: []string{"creds"},
+		Short:   "Manage passwords in the local credential store",
+		Long: `Manage passwords in the local credential store
+
+Passwords are stored per server and username in a file under the tcli
+configuration directory, encrypted with a passphrase. The passphrase is read
+from TCLI_CREDENTIALS_PASSPHRASE or prompted for. "tcli login" looks up the
+password in the store before prompting for it.
+
+The password to store is taken from --password, --password-stdin,
+--password-file or --password-command, or else prompted for.
+
+Examples:
+	# Store the password of a user
+	tcli credentials set -s SERVER -u USER
+
+	# Store a password read from stdin, for example in CI
+	echo "$PASSWORD" | tcli credentials set -s SERVER -u USER --password-stdin
+
+	# List stored credentials
+	tcli credentials list
+
+	# Remove a stored password
+	tcli credentials delete -s SERVER -u USER
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+	}
+	c.AddCommand(newCmdSet())
+	c.AddCommand(newCmdGet())
+	c.AddCommand(newCmdDelete())
+	c.AddCommand(newCmdList())
+	return c
+}
+
+func newCmdSet() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set",
+		Args:  cobra.NoArgs,
+		Short: "Store the password of a user",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host, username, err := key()
+			if err != nil {
+				return err
+			}
+
+			password, err := auth.PasswordToStore(viper.GetString("server"), username)
+			if err != nil {
+				return err
+			}
+
+			store, err := auth.OpenCredentialStore()
+			if err != nil {
+				return err
+			}
+			if err := store.Set(host, username, password); err != nil {
+				return err
+			}
+			fmt.Printf("Stored password for %q on %s\n", username, host)
+			return nil
+		},
+	}
+}
+
+func newCmdGet() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get",
+		Args:  cobra.NoArgs,
+		Short: "Print the stored password of a user",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host, username, err := key()
+			if err != nil {
+				return err
+			}
+			store, err := auth.OpenCredentialStore()
+			if err != nil {
+				return err
+			}
+			password, err := store.Get(host, username)
+			if errors.Is(err, credstore.ErrNotFound) {
+				return fmt.Errorf("no password stored for %q on %s", username, host)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(password)
+			return nil
+		},
+	}
+}
+
+func newCmdDelete() *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete",
+		Aliases: []string{"rm"},
+		Args:    cobra.NoArgs,
+		Short:   "Remove the stored password of a user",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host, username, err := key()
+			if err != nil {
+				return err
+			}
+			store, err := auth.OpenCredentialStore()
+			if err != nil {
+				return err
+			}
+			err = store.Delete(host, username)
+			if errors.Is(err, credstore.ErrNotFound) {
+				return fmt.Errorf("no password stored for %q on %s", username, host)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Removed password for %q on %s\n", username, host)
+			return nil
+		},
+	}
+}
+
+func newCmdList() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Args:    cobra.NoArgs,
+		Short:   "List stored credentials",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := auth.OpenCredentialStore()
+			if err != nil {
+				return err
+			}
+			keys, err := store.List()
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				fmt.Println("No credentials stored")
+				return nil
+			}
+			table := &v1.Table{
+				ColumnDefinitions: []v1.TableColumnDefinition{
+					{Name: "SERVER", Type: "string"},
+					{Name: "USERNAME", Type: "string"},
+				},
+			}
+			for _, k := range keys {
+				table.Rows = append(table.Rows, v1.TableRow{Cells: []interface{}{k.Server, k.Username}})
+			}
+			printer := printers.NewTablePrinter(printers.PrintOptions{})
+			return printer.PrintObj(table, os.Stdout)
+		},
+	}
+}
+
+// key returns the supervisor host and username given by --server and
+// --username, which identify a stored password
+func key() (string, string, error) {
+	server := viper.GetString("server")
+	username := viper.GetString("username")
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing server URL: %w", err)
+	}
+	if len(u.Host) == 0 || len(username) == 0 {
+		return "", "", errors.New("both --server and --username are required")
+	}
+	return u.Host, username, nil
+}
@@ -0,0 +1,140 @@
+package devserver
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/pkg/supervisortest"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var (
+	listenAddr  string
+	users       []string
+	namespaces  []string
+	clusters    []string
+	tokenExpiry time.Duration
+	latency     time.Duration
+	errorRate   float64
+	errorStatus int
+	tlsErrors   bool
+	caFile      string
+)
+
+func NewCmdDevServer() *cobra.Command {
+	c := &cobra.Command{
+		Use:    "dev-server",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		Short:  "Run a local supervisor simulator for end-to-end testing",
+		Long: `Run a local supervisor simulator for end-to-end testing.
+
+The simulator serves the WCP login and workloads endpoints as well as the
+run.tanzu.vmware.com APIs using a self-signed certificate, so that tcli can be
+used without access to a vSphere lab.
+
+Examples:
+	# Start the simulator with the default dev user and cluster
+	tcli dev-server
+
+	# Configure users, namespaces and clusters
+	tcli dev-server --user bob:secret:team-a,team-b --cluster team-a/prod --cluster team-b/test
+
+	# Label clusters to try out label selectors
+	tcli dev-server --cluster dev/web:env=prod,tier=frontend --cluster dev/db:env=prod
+
+	# Make tokens expire quickly and fail a fifth of all requests
+	tcli dev-server --token-expiry 1m --error-rate 0.2 --error-status 500
+
+	# In another terminal
+	tcli login -s https://127.0.0.1:8443 -u dev -p dev --insecure dev-cluster
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := []supervisortest.Option{
+				supervisortest.WithLogger(slog.Default()),
+				supervisortest.WithNamespaces(namespaces...),
+				supervisortest.WithTokenExpiry(tokenExpiry),
+				supervisortest.WithFaults(supervisortest.Faults{
+					Latency:    latency,
+					ErrorRate:  errorRate,
+					StatusCode: errorStatus,
+					TLSError:   tlsErrors,
+				}),
+			}
+
+			for _, u := range users {
+				parts := strings.SplitN(u, ":", 3)
+				if len(parts) < 2 {
+					return fmt.Errorf("invalid user %q, expected USERNAME:PASSWORD[:NAMESPACE,...]", u)
+				}
+				var ns []string
+				if len(parts) == 3 && len(parts[2]) > 0 {
+					ns = strings.Split(parts[2], ",")
+				}
+				opts = append(opts, supervisortest.WithUser(parts[0], parts[1], ns...))
+			}
+
+			for _, cl := range clusters {
+				cl, labelSpec, _ := strings.Cut(cl, ":")
+				ns, name, ok := strings.Cut(cl, "/")
+				if !ok || len(ns) == 0 || len(name) == 0 {
+					return fmt.Errorf("invalid cluster %q, expected NAMESPACE/NAME[:LABELS]", cl)
+				}
+				clusterLabels, err := labels.ConvertSelectorToLabelsMap(labelSpec)
+				if err != nil {
+					return fmt.Errorf("invalid labels of cluster %q: %w", cl, err)
+				}
+				opts = append(opts, supervisortest.WithCluster(supervisortest.Cluster{
+					Namespace: ns,
+					Name:      name,
+					Labels:    clusterLabels,
+					Workers:   2,
+				}))
+			}
+
+			l, err := net.Listen("tcp", listenAddr)
+			if err != nil {
+				return fmt.Errorf("listening on %s: %w", listenAddr, err)
+			}
+			opts = append(opts, supervisortest.WithListener(l))
+
+			srv := supervisortest.NewServer(opts...)
+			defer srv.Close()
+
+			if len(caFile) > 0 {
+				if err := os.WriteFile(caFile, srv.CertificatePEM(), 0o644); err != nil {
+					return fmt.Errorf("writing certificate: %w", err)
+				}
+			}
+
+			fmt.Printf("Supervisor simulator listening on %s\n", srv.URL)
+			fmt.Printf("Press Ctrl+C to stop\n")
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			<-ctx.Done()
+			return nil
+		},
+	}
+	c.Flags().StringVar(&listenAddr, "listen", "127.0.0.1:8443", "Address the simulator listens on.")
+	c.Flags().StringArrayVar(&users, "user", []string{"dev:dev"}, "User in the form USERNAME:PASSWORD[:NAMESPACE,...]. Can be repeated.")
+	c.Flags().StringSliceVar(&namespaces, "namespaces", []string{}, "Additional namespaces without any clusters.")
+	c.Flags().StringArrayVar(&clusters, "cluster", []string{"dev/dev-cluster"}, "Cluster in the form NAMESPACE/NAME[:KEY=VALUE,...]. Can be repeated.")
+	c.Flags().DurationVar(&tokenExpiry, "token-expiry", 10*time.Hour, "Lifetime of issued session tokens.")
+	c.Flags().DurationVar(&latency, "latency", 0, "Latency added to every request.")
+	c.Flags().Float64Var(&errorRate, "error-rate", 0, "Fraction (0-1) of requests that fail.")
+	c.Flags().IntVar(&errorStatus, "error-status", 503, "HTTP status code returned for failed requests.")
+	c.Flags().BoolVar(&tlsErrors, "tls-errors", false, "Fail every TLS handshake.")
+	c.Flags().StringVar(&caFile, "ca-file", "", "Write the simulator certificate to this file.")
+	return c
+}
@@ -3,10 +3,13 @@ package inspect
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/cmd/internal/completion"
+	"github.com/middlewaregruppen/tcli/cmd/internal/picker"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -16,39 +19,80 @@ var tanzuNamespace string
 
 func NewCmdInspect() *cobra.Command {
 	c := &cobra.Command{
-		Use:   "inspect CLUSTER",
+		Use:   "inspect [CLUSTER]",
 		Short: "Inspect a specific cluster within a namespace",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MaximumNArgs(1),
+		// Without --namespace the namespace of the context is used
+		ValidArgsFunction: completion.Clusters(false),
 		Long: `Inspect a specific cluster within a namespace
 Examples:
 	# Inspecting will return the raw cluster specification in YAML format
 	tcli inspect NAME -n NAMESPACE
 
+	# Choose the cluster from a list when run in a terminal
+	tcli inspect -n NAMESPACE
+
 	Use "tcli --help" for a list of global command-line options (applies to all commands).
 	`,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			return viper.BindPFlags(cmd.Flags())
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
-			defer cancel()
+			if len(args) == 0 && !picker.Available() {
+				return errors.New("CLUSTER is required when not running in a terminal")
+			}
 
-			tanzuCluster := args[0]
 			tanzuServer := viper.GetString("server")
 			tanzuUsername := viper.GetString("username")
-			insecureSkipVerify := viper.GetBool("insecure")
-			kubeconfig := viper.GetString("kubeconfig")
 
-			c, contextNamespace, err := auth.ClientFromKubeconfig(tanzuServer, kubeconfig, tanzuUsername, insecureSkipVerify)
+			opts, err := auth.ClientOptions(tanzuServer)
+			if err != nil {
+				return err
+			}
+
+			c, contextNamespace, err := auth.ClientFromKubeconfig(tanzuServer, tanzuUsername, opts...)
 			if err != nil {
 				return err
 			}
 
 			// If --namespace was not given, fall back to the namespace stored in the kubeconfig context
+			tanzuNamespace := viper.GetString("namespace")
 			if len(tanzuNamespace) == 0 {
 				tanzuNamespace = contextNamespace
 			}
 
+			var tanzuCluster string
+			if len(args) > 0 {
+				tanzuCluster = args[0]
+			} else {
+				listCtx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+				defer cancel()
+				namespaces := []string{tanzuNamespace}
+				if len(tanzuNamespace) == 0 {
+					nc, err := auth.NamespacesClient(tanzuServer, tanzuUsername, auth.Interactive, opts...)
+					if err != nil {
+						return err
+					}
+					ns, err := nc.Namespaces(listCtx)
+					if err != nil {
+						return err
+					}
+					namespaces = namespaces[:0]
+					for _, n := range ns {
+						namespaces = append(namespaces, n.Namespace)
+					}
+				}
+				chosen, err := picker.Clusters(listCtx, c, namespaces, false)
+				if err != nil {
+					return err
+				}
+				tanzuCluster, tanzuNamespace = chosen[0].Name, chosen[0].Namespace
+			}
+
+			// The timeout starts after the user has chosen a cluster
+			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+			defer cancel()
+
 			cluster, err := c.Cluster(ctx, tanzuNamespace, tanzuCluster)
 			if err != nil {
 				return err
@@ -67,5 +111,6 @@ Examples:
 		},
 	}
 	c.Flags().StringVarP(&tanzuNamespace, "namespace", "n", "", "Namespace in which the Tanzu Kubernetes cluster resides.")
+	_ = c.RegisterFlagCompletionFunc("namespace", completion.Namespaces)
 	return c
 }
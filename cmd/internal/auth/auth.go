@@ -3,13 +3,15 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
+	"time"
 
 	"github.com/middlewaregruppen/tcli/pkg/client"
-	"k8s.io/client-go/tools/clientcmd"
+	"github.com/spf13/viper"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -17,21 +19,28 @@ import (
 // authinfo is missing — i.e. the user has not run "tcli login" yet.
 var ErrNotAuthenticated = errors.New("credentials missing! Please run 'tcli login' to authenticate")
 
-// ClientFromKubeconfig loads the kubeconfig at kubeconfigPath, resolves the
+// ClientFromKubeconfig loads the kubeconfig, resolves the
 // stored session token for the given server, and returns a ready-to-use
 // client.Client together with the resolved namespace from the context.
 //
 // If username is non-empty it overrides the username stored in the context
-// when constructing the authinfo key.
-func ClientFromKubeconfig(server, kubeconfigPath, username string, insecure bool) (client.Client, string, error) {
+// when constructing the authinfo key. opts are applied to the client in
+// addition to the token credentials.
+//
+// When --auto-login is enabled and a password is available from one of the
+// non-interactive credential sources of ResolvePassword, an expired token
+// is renewed by logging in to the supervisor again before the client is
+// returned, and the client logs in again if the supervisor rejects the token.
+// Renewed tokens are written back to the kubeconfig.
+func ClientFromKubeconfig(server, username string, opts ...client.Option) (client.Client, string, error) {
 	u, err := url.Parse(server)
 	if err != nil {
 		return nil, "", fmt.Errorf("parsing server URL: %w", err)
 	}
 
-	conf, err := clientcmd.LoadFromFile(kubeconfigPath)
+	conf, err := LoadKubeconfig()
 	if err != nil {
-		return nil, "", fmt.Errorf("loading kubeconfig: %w", err)
+		return nil, "", err
 	}
 
 	token, namespace, err := TokenFromConfig(conf, u.Host, username)
@@ -39,12 +48,49 @@ func ClientFromKubeconfig(server, kubeconfigPath, username string, insecure bool
 		return nil, "", err
 	}
 
-	c, err := client.New(
-		server,
-		client.WithLogger(slog.Default()),
-		client.WithCredentials(client.TokenCredentials(token)),
-		client.WithInsecure(insecure),
-	)
+	authName := conf.Contexts[u.Host].AuthInfo
+	if len(username) == 0 {
+		_, username, _ = ParseAuthInfoName(authName)
+	} else {
+		authName = fmt.Sprintf("wcp:%s:%s", u.Host, username)
+	}
+
+	var password string
+	if viper.GetBool("auto-login") {
+		password, err = ResolvePassword(server, username, NonInteractive)
+		if err != nil {
+			slog.Debug("auto-login disabled, no password available", "error", err)
+		}
+	}
+
+	if len(password) > 0 {
+		relogin := reauthenticator(server, authName, username, password, opts...)
+
+		// Renew the token up front if it is known to have expired, rather
+		// than waiting for the supervisor to reject it. If the supervisor
+		// can't be reached the expired token is kept, so that responses
+		// cached by CachingClient can still be served.
+		creds := client.TokenCredentials(token)
+		if info, err := ParseToken(token); err == nil && info.Expired(time.Now()) {
+			slog.Debug("session token has expired, logging in again", "server", server, "username", username)
+			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+			defer cancel()
+			renewed, err := relogin(ctx)
+			switch {
+			case client.Unreachable(err):
+				slog.Debug("could not renew expired session", "server", server, "error", err)
+			case err != nil:
+				return nil, "", fmt.Errorf("renewing expired session: %w", err)
+			default:
+				creds = renewed
+			}
+		}
+		opts = append(opts, client.WithCredentials(creds), client.WithReauthenticator(relogin))
+	} else {
+		opts = append(opts, client.WithCredentials(client.TokenCredentials(token)))
+	}
+
+	c, err := client.New(server, opts...)
 	if err != nil {
 		return nil, "", fmt.Errorf("creating client: %w", err)
 	}
@@ -52,6 +98,111 @@ func ClientFromKubeconfig(server, kubeconfigPath, username string, insecure bool
 	return c, namespace, nil
 }
 
+// TokenClient returns a client for server using the session token stored in
+// the kubeconfig as is. Unlike ClientFromKubeconfig it never logs in again,
+// so nothing is written even if the token has expired.
+func TokenClient(server, username string, opts ...client.Option) (client.Client, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server URL: %w", err)
+	}
+	conf, err := LoadKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	token, _, err := TokenFromConfig(conf, u.Host, username)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(server, append(opts, client.WithCredentials(client.TokenCredentials(token)))...)
+}
+
+// NamespacesClient returns a client for listing the namespaces on server
+// that are available to username. The supervisor lists namespaces for the
+// password of the user rather than the session token, so the password is
+// resolved with ResolvePassword in mode. If username is empty the user of the
+// supervisor context is assumed.
+//
+// A password which isn't available without prompting is only asked for once
+// the supervisor has rejected a request without it. Responses cached by
+// CachingClient can then be served without a password, and when the
+// supervisor can't be reached. Requests fail with ErrNoPassword if no
+// password is available in mode.
+func NamespacesClient(server, username string, mode PasswordMode, opts ...client.Option) (client.Client, error) {
+	if len(username) == 0 {
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, fmt.Errorf("parsing server URL: %w", err)
+		}
+		conf, err := LoadKubeconfig()
+		if err != nil {
+			return nil, err
+		}
+		ctx, ok := conf.Contexts[u.Host]
+		if !ok {
+			return nil, ErrNotAuthenticated
+		}
+		_, username, _ = ParseAuthInfoName(ctx.AuthInfo)
+	}
+
+	quiet := mode
+	if quiet == Interactive {
+		quiet = NonInteractive
+	}
+	password, err := ResolvePassword(server, username, quiet)
+	switch {
+	case err == nil:
+		return client.New(server, append(opts, client.WithCredentials(client.BasicCredentials(username, password)))...)
+	case !errors.Is(err, ErrNoPassword):
+		return nil, err
+	}
+	return client.New(server, append(opts, client.WithReauthenticator(func(context.Context) (client.Credentials, error) {
+		password, err := ResolvePassword(server, username, mode)
+		if err != nil {
+			return nil, err
+		}
+		return client.BasicCredentials(username, password), nil
+	}))...)
+}
+
+// reauthenticator returns a client.Reauthenticator that logs in to the
+// supervisor with username and password, and stores the new session token in
+// the authinfo authName of the kubeconfig
+func reauthenticator(server, authName, username, password string, opts ...client.Option) client.Reauthenticator {
+	return func(ctx context.Context) (client.Credentials, error) {
+		c, err := client.New(server, append(opts, client.WithCredentials(client.BasicCredentials(username, password)))...)
+		if err != nil {
+			return nil, err
+		}
+		sess, err := c.Login(ctx, username, password)
+		if err != nil {
+			return nil, err
+		}
+
+		conf, err := LoadKubeconfig()
+		if err != nil {
+			return nil, err
+		}
+		authInfo, ok := conf.AuthInfos[authName]
+		if !ok {
+			authInfo = clientcmdapi.NewAuthInfo()
+			conf.AuthInfos[authName] = authInfo
+		}
+
+		if err := SetToken(authInfo, server, username, "", "", sess.SessionID); err != nil {
+			return nil, err
+		}
+		if authInfo.Exec == nil {
+			if err := SaveKubeconfig(conf); err != nil {
+				return nil, err
+			}
+		}
+
+		slog.Debug("renewed session token", "server", server, "username", username)
+		return client.TokenCredentials(sess.SessionID), nil
+	}
+}
+
 // TokenFromConfig resolves the session token and context namespace from an
 // already-loaded kubeconfig, given the supervisor host (u.Host) and an
 // optional username override.
@@ -61,7 +212,7 @@ func TokenFromConfig(conf *clientcmdapi.Config, host, username string) (token, n
 		return "", "", ErrNotAuthenticated
 	}
 
-	authName := fmt.Sprintf("wcp:%s:%s", host, ctx.AuthInfo)
+	authName := ctx.AuthInfo
 	if len(username) > 0 {
 		authName = fmt.Sprintf("wcp:%s:%s", host, username)
 	}
@@ -71,5 +222,5 @@ func TokenFromConfig(conf *clientcmdapi.Config, host, username string) (token, n
 		return "", "", ErrNotAuthenticated
 	}
 
-	return authInfo.Token, ctx.Namespace, nil
+	return StoredToken(authInfo), ctx.Namespace, nil
 }
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/middlewaregruppen/tcli/pkg/supervisortest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestTokenFromConfig(t *testing.T) {
+	conf := clientcmdapi.NewConfig()
+	conf.AuthInfos["wcp:supervisor.local:bob"] = &clientcmdapi.AuthInfo{Token: "bob-token"}
+	conf.AuthInfos["wcp:supervisor.local:alice"] = &clientcmdapi.AuthInfo{Token: "alice-token"}
+	conf.Contexts["supervisor.local"] = &clientcmdapi.Context{AuthInfo: "wcp:supervisor.local:bob", Namespace: "team-a"}
+
+	// Without a username the user of the supervisor context is used
+	token, namespace, err := TokenFromConfig(conf, "supervisor.local", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "bob-token" || namespace != "team-a" {
+		t.Errorf("got token %q and namespace %q, want bob-token and team-a", token, namespace)
+	}
+
+	if token, _, err := TokenFromConfig(conf, "supervisor.local", "alice"); err != nil || token != "alice-token" {
+		t.Errorf("got token %q, %v for alice, want alice-token", token, err)
+	}
+	if _, _, err := TokenFromConfig(conf, "supervisor.local", "carol"); !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("got %v for a user without a token, want ErrNotAuthenticated", err)
+	}
+	if _, _, err := TokenFromConfig(conf, "other.local", ""); !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("got %v for a supervisor without a context, want ErrNotAuthenticated", err)
+	}
+}
+
+func TestNamespacesClientWithoutPassword(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+	srv := supervisortest.NewServer(supervisortest.WithUser("alice", "pa55"), supervisortest.WithNamespaces("team-a"))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	withPassword, err := client.New(srv.URL, client.WithClient(srv.HTTPClient()), client.WithCredentials(client.BasicCredentials("alice", "pa55")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.NewCachingClient(withPassword, dir).Namespaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := NamespacesClient(srv.URL, "alice", NonInteractive, client.WithClient(srv.HTTPClient()))
+	if err != nil {
+		t.Fatalf("creating a client without a password: %v", err)
+	}
+	c := client.NewCachingClient(nc, dir, client.WithCacheTTL(0))
+	if _, err := c.Namespaces(context.Background()); !errors.Is(err, ErrNoPassword) {
+		t.Errorf("got %v from a reachable supervisor, want ErrNoPassword", err)
+	}
+
+	// Without a password cached namespaces are still served offline
+	srv.Close()
+	ns, err := c.Namespaces(context.Background())
+	if err != nil {
+		t.Fatalf("cached namespaces weren't served offline: %v", err)
+	}
+	if len(ns) != 1 || ns[0].Namespace != "team-a" {
+		t.Errorf("got namespaces %v, want team-a", ns)
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ContextExtension is the name of the kubeconfig context extension in which
+// "tcli login" records what a context was logged in to
+const ContextExtension = "tcli"
+
+// ContextInfo records the supervisor, and for guest cluster contexts the
+// cluster, that a context was logged in to. It allows commands such as
+// "tcli refresh" to log in to the context again.
+type ContextInfo struct {
+	// Server is the URL of the supervisor
+	Server string `json:"server"`
+	// Namespace is the supervisor namespace of the guest cluster
+	Namespace string `json:"namespace,omitempty"`
+	// Cluster is the name of the guest cluster, empty for supervisor contexts
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// SetContextInfo stores info as an extension of ctx
+func SetContextInfo(ctx *clientcmdapi.Context, info ContextInfo) error {
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if ctx.Extensions == nil {
+		ctx.Extensions = map[string]runtime.Object{}
+	}
+	ctx.Extensions[ContextExtension] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	return nil
+}
+
+// GetContextInfo returns what ctx was logged in to. Contexts written by older
+// versions of tcli have no extension, in which case the information is taken
+// from the exec entry of authInfo if it has one. ok is false if neither is
+// available.
+func GetContextInfo(ctx *clientcmdapi.Context, authInfo *clientcmdapi.AuthInfo) (info ContextInfo, ok bool) {
+	if ext, found := ctx.Extensions[ContextExtension].(*runtime.Unknown); found {
+		if err := json.Unmarshal(ext.Raw, &info); err == nil && len(info.Server) > 0 {
+			return info, true
+		}
+	}
+	if authInfo != nil && authInfo.Exec != nil {
+		server, _, namespace, cluster := parseExecArgs(authInfo.Exec.Args)
+		if len(server) > 0 {
+			return ContextInfo{Server: server, Namespace: namespace, Cluster: cluster}, true
+		}
+	}
+	return ContextInfo{}, false
+}
+
+// Info returns what the managed context was logged in to, see
+// GetContextInfo. Supervisor contexts written by older versions of tcli are
+// assumed to have been logged in to https://HOST.
+func (mc ManagedContext) Info() (ContextInfo, bool) {
+	if info, ok := GetContextInfo(mc.Context, mc.AuthInfo); ok {
+		return info, true
+	}
+	if mc.Supervisor {
+		return ContextInfo{Server: "https://" + mc.Host}, true
+	}
+	return ContextInfo{}, false
+}
+
+// SetToken stores a renewed session token in authInfo. Exec credential
+// entries have their token cached outside of the kubeconfig instead, where
+// "tcli credential" looks for it.
+func SetToken(authInfo *clientcmdapi.AuthInfo, server, username, namespace, cluster, token string) error {
+	if authInfo == nil {
+		return errors.New("the context has no user entry to store the token in")
+	}
+	if authInfo.Exec == nil {
+		authInfo.Token = token
+		return nil
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+	return StoreToken(u.Host, username, namespace, cluster, token)
+}
+
+// RemoveContext deletes the managed context from conf together with its
+// authinfo and cluster, unless they are used by other contexts. The names of
+// the authinfo and cluster are returned if they were deleted.
+func RemoveContext(conf *clientcmdapi.Config, mc ManagedContext) (authInfo, cluster string) {
+	delete(conf.Contexts, mc.Name)
+	if conf.CurrentContext == mc.Name {
+		conf.CurrentContext = ""
+	}
+	authInUse, clusterInUse := false, false
+	for _, ctx := range conf.Contexts {
+		authInUse = authInUse || ctx.AuthInfo == mc.Context.AuthInfo
+		clusterInUse = clusterInUse || ctx.Cluster == mc.Context.Cluster
+	}
+	if _, ok := conf.AuthInfos[mc.Context.AuthInfo]; ok && !authInUse {
+		delete(conf.AuthInfos, mc.Context.AuthInfo)
+		authInfo = mc.Context.AuthInfo
+	}
+	if _, ok := conf.Clusters[mc.Context.Cluster]; ok && !clusterInUse {
+		delete(conf.Clusters, mc.Context.Cluster)
+		cluster = mc.Context.Cluster
+	}
+	return authInfo, cluster
+}
+
+// DeleteContextToken deletes the token cached for the managed context if it
+// is an exec credential entry
+func DeleteContextToken(mc ManagedContext) {
+	if mc.AuthInfo == nil || mc.AuthInfo.Exec == nil {
+		return
+	}
+	info, ok := mc.Info()
+	if !ok {
+		return
+	}
+	u, err := url.Parse(info.Server)
+	if err != nil {
+		return
+	}
+	if err := DeleteToken(u.Host, mc.Username, info.Namespace, info.Cluster); err != nil {
+		slog.Warn("could not delete cached token", "context", mc.Name, "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/middlewaregruppen/tcli/pkg/credstore"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// ConfigDir returns the tcli configuration directory, usually ~/.config/tcli
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tcli"), nil
+}
+
+// errPassphraseRequired is returned by the passphrase of credential stores
+// opened non-interactively when TCLI_CREDENTIALS_PASSPHRASE isn't set
+var errPassphraseRequired = errors.New("credential store passphrase required, set TCLI_CREDENTIALS_PASSPHRASE")
+
+// OpenCredentialStore opens the credential store selected by
+// --credential-store. The passphrase of encrypted stores is read from
+// TCLI_CREDENTIALS_PASSPHRASE, or prompted for if a terminal is available,
+// twice when the store is created.
+func OpenCredentialStore() (credstore.Backend, error) {
+	return openCredentialStore(true)
+}
+
+// openCredentialStore is OpenCredentialStore, which only prompts for the
+// passphrase if interactive is true
+func openCredentialStore(interactive bool) (credstore.Backend, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	name := viper.GetString("credential-store")
+	if len(name) == 0 {
+		name = credstore.FileBackendName
+	}
+	return credstore.Open(name, credstore.Options{
+		Dir:        dir,
+		Passphrase: passphrase(interactive),
+	})
+}
+
+// StoredPassword returns the password stored in the credential store for
+// username on server, or an empty string if there is none. The passphrase of
+// the store is only prompted for if interactive is true.
+func StoredPassword(server, username string, interactive bool) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("parsing server URL: %w", err)
+	}
+	store, err := openCredentialStore(interactive)
+	if err != nil {
+		return "", err
+	}
+	password, err := store.Get(u.Host, username)
+	if errors.Is(err, credstore.ErrNotFound) {
+		return "", nil
+	}
+	return password, err
+}
+
+// passphrase returns the passphrase function of the credential store, which
+// only prompts if interactive is true
+func passphrase(interactive bool) func(create bool) ([]byte, error) {
+	return func(create bool) ([]byte, error) {
+		if p := viper.GetString("credentials-passphrase"); len(p) > 0 {
+			return []byte(p), nil
+		}
+		if !interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errPassphraseRequired
+		}
+		prompt := "Credential store passphrase:"
+		if create {
+			prompt = "New credential store passphrase:"
+		}
+		p, err := readPassphrase(prompt)
+		if err != nil || !create {
+			return p, err
+		}
+
+		// A typo in a new passphrase would lock the user out of the store
+		again, err := readPassphrase("Repeat the passphrase:")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(p, again) {
+			return nil, errors.New("the passphrases don't match")
+		}
+		return p, nil
+	}
+}
+
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintf(os.Stderr, "\n")
+	return p, err
+}
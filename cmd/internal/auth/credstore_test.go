@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestStoredPasswordLocked(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	viper.Set("credentials-passphrase", "secret")
+	t.Cleanup(func() { viper.Set("credentials-passphrase", "") })
+
+	store, err := OpenCredentialStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("supervisor.local", "bob", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := StoredPassword("https://supervisor.local", "bob", false); err != nil || p != "hunter2" {
+		t.Fatalf("got %q, %v with the passphrase set", p, err)
+	}
+
+	// Without the passphrase the store must not be unlocked by prompting
+	viper.Set("credentials-passphrase", "")
+	if _, err := StoredPassword("https://supervisor.local", "bob", false); !errors.Is(err, errPassphraseRequired) {
+		t.Errorf("got %v, want errPassphraseRequired", err)
+	}
+}
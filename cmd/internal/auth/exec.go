@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"net/url"
+	"os"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ExecAPIVersion is the client.authentication.k8s.io version implemented by
+// "tcli credential"
+const ExecAPIVersion = "client.authentication.k8s.io/v1"
+
+// ExecConfig returns a kubeconfig exec entry which makes kubectl obtain
+// tokens for the given supervisor and guest cluster by running
+// "tcli credential". cluster is empty for the supervisor itself. The
+// connection flags of the current invocation, such as --insecure, are passed
+// on to "tcli credential".
+func ExecConfig(server, username, namespace, cluster string) *clientcmdapi.ExecConfig {
+	command, err := os.Executable()
+	if err != nil {
+		command = "tcli"
+	}
+
+	args := []string{"credential", "--server", server, "--username", username}
+	if len(cluster) > 0 {
+		args = append(args, "--cluster", cluster)
+	}
+	if len(namespace) > 0 {
+		args = append(args, "--namespace", namespace)
+	}
+	args = append(args, ConnectionArgs()...)
+
+	return &clientcmdapi.ExecConfig{
+		APIVersion:      ExecAPIVersion,
+		Command:         command,
+		Args:            args,
+		InteractiveMode: clientcmdapi.IfAvailableExecInteractiveMode,
+		InstallHint:     "tcli is required to authenticate to this cluster. Download it from https://github.com/middlewaregruppen/tcli/releases",
+	}
+}
+
+// StoredToken returns the session token of a tcli authinfo. The token is
+// either embedded in the kubeconfig or, for exec credential entries, cached
+// by "tcli credential". The token may have expired.
+func StoredToken(authInfo *clientcmdapi.AuthInfo) string {
+	if authInfo == nil {
+		return ""
+	}
+	if len(authInfo.Token) > 0 || authInfo.Exec == nil {
+		return authInfo.Token
+	}
+
+	server, username, namespace, cluster := parseExecArgs(authInfo.Exec.Args)
+	u, err := url.Parse(server)
+	if err != nil {
+		return ""
+	}
+	token, _ := readCachedToken(u.Host, username, namespace, cluster)
+	return token
+}
+
+// parseExecArgs returns the flags of an exec entry written by ExecConfig
+func parseExecArgs(args []string) (server, username, namespace, cluster string) {
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--server":
+			server = args[i+1]
+		case "--username":
+			username = args[i+1]
+		case "--namespace":
+			namespace = args[i+1]
+		case "--cluster":
+			cluster = args[i+1]
+		}
+	}
+	return server, username, namespace, cluster
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/middlewaregruppen/tcli/pkg/kubeconfig"
+
+	"github.com/spf13/viper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ErrReplayKubeconfig is returned by SaveKubeconfig when --replay is given
+// without --kubeconfig
+var ErrReplayKubeconfig = errors.New("not writing the redacted tokens of --replay to your kubeconfig, give a scratch file with --kubeconfig")
+
+// LoadingRules returns the rules used to find the kubeconfig files. A
+// kubeconfig given by --kubeconfig, TCLI_KUBECONFIG or a profile is used on
+// its own. Otherwise the files listed in KUBECONFIG are merged like kubectl
+// does, falling back to ~/.kube/config.
+func LoadingRules() *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if viper.IsSet("kubeconfig") {
+		rules.ExplicitPath = viper.GetString("kubeconfig")
+	}
+	return rules
+}
+
+var (
+	kubeconfigStoresMu sync.Mutex
+	kubeconfigStores   = map[string]*kubeconfig.Store{}
+)
+
+// KubeconfigStore returns the store for the kubeconfig files of
+// LoadingRules. The files are backed up to the tcli configuration directory
+// before they are changed, keeping as many backups as --kubeconfig-backups.
+// It must not be called before the flags have been parsed.
+func KubeconfigStore() *kubeconfig.Store {
+	rules := LoadingRules()
+	key := rules.ExplicitPath + string(filepath.ListSeparator) + strings.Join(rules.GetLoadingPrecedence(), string(filepath.ListSeparator))
+
+	kubeconfigStoresMu.Lock()
+	defer kubeconfigStoresMu.Unlock()
+	if store, ok := kubeconfigStores[key]; ok {
+		return store
+	}
+	var opts []kubeconfig.Option
+	if dir, err := ConfigDir(); err == nil {
+		opts = append(opts, kubeconfig.WithBackups(filepath.Join(dir, "kubeconfig-backups"), viper.GetInt("kubeconfig-backups")))
+	} else {
+		slog.Warn("kubeconfig backups disabled", "error", err)
+	}
+	store := kubeconfig.NewStore(rules, opts...)
+	kubeconfigStores[key] = store
+	return store
+}
+
+// LoadKubeconfig loads the kubeconfig, merging the files of LoadingRules
+func LoadKubeconfig() (*clientcmdapi.Config, error) {
+	conf, err := KubeconfigStore().Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	return conf, nil
+}
+
+// SaveKubeconfig writes the changes made to a kubeconfig loaded by
+// LoadKubeconfig, keeping changes made by other tcli processes in the
+// meantime. See kubeconfig.Store. With --replay the tokens are those of the
+// recording, which are redacted, so the kubeconfig is only written if it was
+// given explicitly.
+func SaveKubeconfig(conf *clientcmdapi.Config) error {
+	if len(viper.GetString("replay")) > 0 && !viper.IsSet("kubeconfig") {
+		return ErrReplayKubeconfig
+	}
+	if err := KubeconfigStore().Save(conf); err != nil {
+		return fmt.Errorf("writing kubeconfig: %w", err)
+	}
+	return nil
+}
+
+// SplitDir is the directory that "tcli login --split" writes kubeconfig files
+// to
+var SplitDir = filepath.Join(clientcmd.RecommendedConfigDir, "tcli")
+
+// SplitPath returns the path of the kubeconfig file in dir holding only the
+// context name
+func SplitPath(dir, name string) string {
+	return filepath.Join(dir, unsafeFileChars.ReplaceAllString(name, "-")+".yaml")
+}
+
+// WriteSplit writes the context name of conf, together with its cluster and
+// authinfo, to a self-contained kubeconfig file in dir in which it is the
+// current context. The path of the file is returned.
+func WriteSplit(conf *clientcmdapi.Config, dir, name string) (string, error) {
+	ctx, ok := conf.Contexts[name]
+	if !ok {
+		return "", fmt.Errorf("context %q not found", name)
+	}
+	split := clientcmdapi.NewConfig()
+	split.Contexts[name] = ctx
+	if cluster, ok := conf.Clusters[ctx.Cluster]; ok {
+		split.Clusters[ctx.Cluster] = cluster
+	}
+	if authInfo, ok := conf.AuthInfos[ctx.AuthInfo]; ok {
+		split.AuthInfos[ctx.AuthInfo] = authInfo
+	}
+	split.CurrentContext = name
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := SplitPath(dir, name)
+	if err := kubeconfig.WriteFile(split, path); err != nil {
+		return "", fmt.Errorf("writing %s: %w", path, err)
+	}
+	return path, nil
+}
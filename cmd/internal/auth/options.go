@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/middlewaregruppen/tcli/pkg/trust"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+var (
+	recorderOnce sync.Once
+	recorder     *os.File
+	recorderErr  error
+
+	replayerOnce sync.Once
+	replayer     *client.Replayer
+	replayerErr  error
+
+	trustStoreOnce sync.Once
+	trustStore     *trust.Store
+	trustStoreErr  error
+
+	promptsDisabled bool
+)
+
+// DisablePrompts makes tcli fail rather than ask the user whether to trust a
+// certificate, even when stdin is a terminal. Shell completion runs tcli with
+// the terminal as stdin, but must never wait for input.
+func DisablePrompts() {
+	promptsDisabled = true
+}
+
+// ClientOptions returns the client options for connecting to server, as
+// configured by the global flags such as --insecure, --certificate-authority,
+// --proxy, --record and --replay. The record and replay files are opened once and
+// shared by every client created by the command, so that a recording covers
+// the whole invocation.
+//
+// Unless --insecure is given, certificates that can't be verified are pinned
+// on first use after asking the user, see package trust.
+func ClientOptions(server string) ([]client.Option, error) {
+	opts := []client.Option{
+		client.WithLogger(slog.Default()),
+		client.WithInsecure(viper.GetBool("insecure")),
+	}
+
+	caData, err := CAData()
+	if err != nil {
+		return nil, err
+	}
+	if len(caData) > 0 {
+		opts = append(opts, client.WithCA(caData))
+	}
+	if name := viper.GetString("tls-server-name"); len(name) > 0 {
+		opts = append(opts, client.WithTLSServerName(name))
+	}
+	if proxy := viper.GetString("proxy"); len(proxy) > 0 {
+		opts = append(opts, client.WithProxy(proxy))
+	}
+
+	if !viper.GetBool("insecure") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, fmt.Errorf("parsing server URL: %w", err)
+		}
+		store, err := TrustStore()
+		if err != nil {
+			return nil, fmt.Errorf("loading trusted certificates: %w", err)
+		}
+		var roots *x509.CertPool
+		if len(caData) > 0 {
+			roots = x509.NewCertPool()
+			roots.AppendCertsFromPEM(caData)
+		}
+		verify := store.VerifyConnection(u.Host, viper.GetString("tls-server-name"), roots, promptTrust)
+		opts = append(opts, client.WithVerifyConnection(verify))
+	}
+
+	if path := viper.GetString("record"); len(path) > 0 {
+		recorderOnce.Do(func() {
+			recorder, recorderErr = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		})
+		if recorderErr != nil {
+			return nil, fmt.Errorf("opening recording: %w", recorderErr)
+		}
+		opts = append(opts, client.WithRecorder(recorder))
+	}
+
+	if path := viper.GetString("replay"); len(path) > 0 {
+		replayerOnce.Do(func() {
+			var f *os.File
+			f, replayerErr = os.Open(path)
+			if replayerErr != nil {
+				return
+			}
+			defer f.Close()
+			replayer, replayerErr = client.NewReplayer(f)
+		})
+		if replayerErr != nil {
+			return nil, fmt.Errorf("opening replay: %w", replayerErr)
+		}
+		opts = append(opts, client.WithReplayer(replayer))
+	}
+
+	return opts, nil
+}
+
+// CAData returns the contents of the --certificate-authority file, or nil if
+// the flag isn't set
+func CAData() ([]byte, error) {
+	path := viper.GetString("certificate-authority")
+	if len(path) == 0 {
+		return nil, nil
+	}
+	if viper.GetBool("insecure") {
+		return nil, errors.New("--certificate-authority and --insecure are mutually exclusive")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading certificate authority: %w", err)
+	}
+	return b, nil
+}
+
+// ConnectionArgs returns the global flags that affect how tcli connects to
+// the supervisor, for passing on to tcli when it is run by kubectl
+func ConnectionArgs() []string {
+	var args []string
+	if viper.GetBool("insecure") {
+		args = append(args, "--insecure")
+	}
+	if path := viper.GetString("certificate-authority"); len(path) > 0 {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		args = append(args, "--certificate-authority", path)
+	}
+	if name := viper.GetString("tls-server-name"); len(name) > 0 {
+		args = append(args, "--tls-server-name", name)
+	}
+	if proxy := viper.GetString("proxy"); len(proxy) > 0 {
+		args = append(args, "--proxy", proxy)
+	}
+	return args
+}
+
+// TrustStore returns the store of supervisor certificates pinned on first
+// use, located in the tcli configuration directory
+func TrustStore() (*trust.Store, error) {
+	trustStoreOnce.Do(func() {
+		var dir string
+		dir, trustStoreErr = ConfigDir()
+		if trustStoreErr != nil {
+			return
+		}
+		trustStore, trustStoreErr = trust.Load(filepath.Join(dir, "known_hosts"))
+	})
+	return trustStore, trustStoreErr
+}
+
+// PinnedCA returns the PEM encoded CA certificate pinned for server, or nil
+// if its certificate isn't pinned
+func PinnedCA(server string) ([]byte, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	store, err := TrustStore()
+	if err != nil {
+		return nil, err
+	}
+	pin, ok := store.Get(u.Host)
+	if !ok || len(pin.CA) == 0 {
+		return nil, nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pin.CA}), nil
+}
+
+// promptTrust asks the user on the terminal whether to trust a certificate
+// that couldn't be verified
+func promptTrust(host string, chain []*x509.Certificate, verifyErr error) (bool, error) {
+	leaf := chain[0]
+	if promptsDisabled || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("%w: %v. Run tcli in a terminal to trust the certificate with fingerprint %s, or use --certificate-authority",
+			trust.ErrUntrusted, verifyErr, trust.Fingerprint(leaf))
+	}
+
+	fmt.Fprintf(os.Stderr, "The authenticity of supervisor %s can't be established: %v\n", host, verifyErr)
+	fmt.Fprintf(os.Stderr, "  Subject:     %s\n", leaf.Subject)
+	fmt.Fprintf(os.Stderr, "  Issuer:      %s\n", leaf.Issuer)
+	fmt.Fprintf(os.Stderr, "  Expires:     %s\n", leaf.NotAfter.Local().Format(time.RFC1123))
+	fmt.Fprintf(os.Stderr, "  Fingerprint: %s\n", trust.Fingerprint(leaf))
+	fmt.Fprintf(os.Stderr, "Do you want to trust this certificate? [y/N]: ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
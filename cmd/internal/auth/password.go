@@ -0,0 +1,356 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// ErrNoPassword is returned by ResolvePassword when none of the credential
+// sources provided a password
+var ErrNoPassword = errors.New("no password provided, use --password-stdin, --password-file, --password-command, the credential store or run tcli in a terminal")
+
+var (
+	stdinOnce     sync.Once
+	stdinPassword string
+	stdinErr      error
+
+	passwordsMu sync.Mutex
+	passwords   = map[string]string{}
+)
+
+// PasswordMode selects the credential sources ResolvePassword may use, and
+// whether it may prompt
+type PasswordMode int
+
+const (
+	// Interactive uses every credential source, and prompts for the
+	// password and the credential store passphrase if stdin is a terminal
+	Interactive PasswordMode = iota
+	// NonInteractive uses every credential source, but never prompts
+	NonInteractive
+	// Passive only uses the sources without side effects: --password,
+	// --password-file, the credential store if TCLI_CREDENTIALS_PASSPHRASE
+	// unlocks it, and ~/.netrc. Stdin isn't read and --password-command
+	// isn't run. It is meant for shell completion.
+	Passive
+)
+
+// passwordSource returns the password of username on server, or an empty
+// string if the source has none
+type passwordSource struct {
+	name string
+	get  func(u *url.URL, username string, mode PasswordMode) (string, error)
+	// passive is true if the source may be used in Passive mode
+	passive bool
+}
+
+var passwordSources = []passwordSource{
+	{"flag", func(*url.URL, string, PasswordMode) (string, error) { return viper.GetString("password"), nil }, true},
+	{"stdin", passwordFromStdin, false},
+	{"file", passwordFromFile, true},
+	{"command", passwordFromCommand, false},
+	{"credential store", func(u *url.URL, username string, mode PasswordMode) (string, error) {
+		// A locked or unreadable store shouldn't prevent other sources from
+		// being used
+		p, err := StoredPassword(u.String(), username, mode == Interactive)
+		switch {
+		case errors.Is(err, errPassphraseRequired):
+			slog.Debug("credential store is locked", "error", err)
+		case err != nil:
+			slog.Warn("could not read password from credential store", "error", err)
+		}
+		return p, nil
+	}, true},
+	{"netrc", passwordFromNetrc, true},
+}
+
+// ResolvePassword returns the password of username on server. The credential
+// sources are tried in order:
+//
+//  1. --password or TCLI_PASSWORD
+//  2. --password-stdin
+//  3. --password-file or TCLI_PASSWORD_FILE
+//  4. --password-command or TCLI_PASSWORD_COMMAND
+//  5. the credential store
+//  6. ~/.netrc, matched on the server hostname and username
+//
+// mode limits the sources which are used, see PasswordMode. If none of them
+// has a password and mode is Interactive, the password is prompted for, but
+// only if stdin is a terminal. Resolved passwords are remembered for the rest
+// of the invocation.
+func ResolvePassword(server, username string, mode PasswordMode) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("parsing server URL: %w", err)
+	}
+
+	cacheKey := u.Host + "/" + username
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+	if p, ok := passwords[cacheKey]; ok {
+		return p, nil
+	}
+	p, err := resolvePassword(u, username, mode, "")
+	if err != nil {
+		return "", err
+	}
+	passwords[cacheKey] = p
+	return p, nil
+}
+
+// PasswordToStore returns the password of username on server to be stored in
+// the credential store. It is resolved like ResolvePassword in Interactive
+// mode, except that neither the credential store itself nor passwords
+// resolved earlier are looked in.
+func PasswordToStore(server, username string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("parsing server URL: %w", err)
+	}
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+	return resolvePassword(u, username, Interactive, "credential store")
+}
+
+// resolvePassword tries the credential sources in order, skipping the source
+// named skip, and prompts if mode allows it
+func resolvePassword(u *url.URL, username string, mode PasswordMode, skip string) (string, error) {
+	for _, src := range passwordSources {
+		if src.name == skip || mode == Passive && !src.passive {
+			continue
+		}
+		p, err := src.get(u, username, mode)
+		if err != nil {
+			return "", fmt.Errorf("reading password from %s: %w", src.name, err)
+		}
+		if len(p) > 0 {
+			slog.Debug("resolved password", "source", src.name, "server", u.Host, "username", username)
+			return p, nil
+		}
+	}
+
+	if mode != Interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", ErrNoPassword
+	}
+	fmt.Fprintf(os.Stderr, "Password:")
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintf(os.Stderr, "\n")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func passwordFromStdin(*url.URL, string, PasswordMode) (string, error) {
+	if !viper.GetBool("password-stdin") {
+		return "", nil
+	}
+	stdinOnce.Do(func() {
+		var b []byte
+		b, stdinErr = io.ReadAll(os.Stdin)
+		stdinPassword = strings.TrimRight(string(b), "\r\n")
+	})
+	if stdinErr == nil && len(stdinPassword) == 0 {
+		return "", errors.New("--password-stdin given but stdin is empty")
+	}
+	return stdinPassword, stdinErr
+}
+
+func passwordFromFile(*url.URL, string, PasswordMode) (string, error) {
+	path := viper.GetString("password-file")
+	if len(path) == 0 {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	// Only the first line holds the password, comments may follow
+	password, _, _ := strings.Cut(string(b), "\n")
+	return strings.TrimRight(password, "\r"), nil
+}
+
+// passwordFromCommand runs --password-command and returns its output. The
+// command is split into arguments and executed directly, without a shell.
+func passwordFromCommand(*url.URL, string, PasswordMode) (string, error) {
+	command := viper.GetString("password-command")
+	if len(command) == 0 {
+		return "", nil
+	}
+	args, err := splitCommand(command)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return "", errors.New("password command is empty")
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %q: %w", args[0], err)
+	}
+	// Tools like pass print the password on the first line
+	password, _, _ := strings.Cut(stdout.String(), "\n")
+	return strings.TrimRight(password, "\r"), nil
+}
+
+// splitCommand splits s into arguments the way a POSIX shell would, honoring
+// single quotes, double quotes and backslash escapes. No expansion of any
+// kind is performed.
+func splitCommand(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// passwordFromNetrc looks up the password in the netrc file given by $NETRC,
+// or ~/.netrc, matching the machine on the server hostname
+func passwordFromNetrc(u *url.URL, username string, _ PasswordMode) (string, error) {
+	path := os.Getenv("NETRC")
+	if len(path) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	entries, err := parseNetrc(f)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for _, e := range entries {
+		if (e.machine == u.Hostname() || e.machine == u.Host || e.machine == "") &&
+			(len(e.login) == 0 || e.login == username) {
+			return e.password, nil
+		}
+	}
+	return "", nil
+}
+
+// netrcEntry is a machine entry of a netrc file. machine is empty for the
+// default entry.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+func parseNetrc(r io.Reader) ([]netrcEntry, error) {
+	var (
+		entries []netrcEntry
+		cur     *netrcEntry
+		tokens  []string
+	)
+	scanner := bufio.NewScanner(r)
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Macro definitions run until the next empty line
+		if inMacro {
+			inMacro = len(strings.TrimSpace(line)) > 0
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			if fields[i] == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, fields[i])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine", "default":
+			entries = append(entries, netrcEntry{})
+			cur = &entries[len(entries)-1]
+			if tokens[i] == "machine" && i+1 < len(tokens) {
+				i++
+				cur.machine = tokens[i]
+			}
+		case "login", "password", "account":
+			if cur == nil || i+1 >= len(tokens) {
+				return nil, fmt.Errorf("%q without machine or value", tokens[i])
+			}
+			i++
+			switch tokens[i-1] {
+			case "login":
+				cur.login = tokens[i]
+			case "password":
+				cur.password = tokens[i]
+			}
+		}
+	}
+	return entries, nil
+}
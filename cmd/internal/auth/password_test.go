@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPasswordFromFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"single line", "hunter2", "hunter2"},
+		{"trailing newline", "hunter2\n", "hunter2"},
+		{"windows line ending", "hunter2\r\n", "hunter2"},
+		{"second line", "hunter2\n# vsphere password of bob\n", "hunter2"},
+		{"second line after CRLF", "hunter2\r\nsomething else\r\n", "hunter2"},
+		{"spaces are kept", " hunter 2 \n", " hunter 2 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "password")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			viper.Set("password-file", path)
+			t.Cleanup(func() { viper.Set("password-file", "") })
+
+			got, err := passwordFromFile(nil, "bob", Interactive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `
+machine supervisor.local login bob password hunter2
+machine other.local
+	login alice
+	password pa55
+macdef init
+	echo machine fake.local login x password y
+
+default login carol password fallback
+`
+	entries, err := parseNetrc(strings.NewReader(netrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netrcEntry{
+		{machine: "supervisor.local", login: "bob", password: "hunter2"},
+		{machine: "other.local", login: "alice", password: "pa55"},
+		{machine: "", login: "carol", password: "fallback"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries %+v, want %+v", len(entries), entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d is %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestResolvePasswordPassive(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	marker := filepath.Join(dir, "command-run")
+	viper.Set("password-stdin", true)
+	viper.Set("password-command", "touch "+marker)
+	t.Cleanup(func() {
+		viper.Set("password-stdin", false)
+		viper.Set("password-command", "")
+	})
+
+	netrc := filepath.Join(dir, "netrc")
+	t.Setenv("NETRC", netrc)
+	if _, err := ResolvePassword("https://passive.local", "bob", Passive); !errors.Is(err, ErrNoPassword) {
+		t.Errorf("got %v, want ErrNoPassword", err)
+	}
+	if _, err := os.Stat(marker); !errors.Is(err, os.ErrNotExist) {
+		t.Error("password command was run while resolving passively")
+	}
+
+	if err := os.WriteFile(netrc, []byte("machine passive.local login bob password hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := ResolvePassword("https://passive.local", "bob", Passive); err != nil || p != "hunter2" {
+		t.Errorf("got %q, %v, want the password from netrc", p, err)
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/middlewaregruppen/tcli/pkg/config"
+	"github.com/spf13/viper"
+)
+
+// ConfigFile returns the path of the tcli configuration file, usually
+// ~/.config/tcli/config.yaml
+func ConfigFile() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, config.FileName), nil
+}
+
+// LoadConfig reads the tcli configuration file and returns it together with
+// its path
+func LoadConfig() (*config.Config, string, error) {
+	path, err := ConfigFile()
+	if err != nil {
+		return nil, "", err
+	}
+	conf, err := config.Load(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return conf, path, nil
+}
+
+// SelectedProfile returns the name of the profile selected by --profile or
+// TCLI_PROFILE, or else the current profile of conf. It is empty if no
+// profile is selected.
+func SelectedProfile(conf *config.Config) string {
+	if name := viper.GetString("profile"); len(name) > 0 {
+		return name
+	}
+	return conf.CurrentProfile
+}
+
+// ApplyProfile makes the settings of the selected profile the defaults of
+// the flags they are named after. Flags given on the command line and TCLI_*
+// environment variables take precedence over the profile.
+func ApplyProfile() error {
+	conf, path, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	name := SelectedProfile(conf)
+	if len(name) == 0 {
+		return nil
+	}
+	profile, err := conf.Profile(name)
+	if err != nil {
+		return fmt.Errorf("%w in %s", err, path)
+	}
+	slog.Debug("using profile", "profile", name, "config", path)
+	return viper.MergeConfigMap(profile.Settings())
+}
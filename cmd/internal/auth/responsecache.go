@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/spf13/viper"
+)
+
+// ResponseCacheDir returns the directory where the responses of the
+// supervisor are cached
+func ResponseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tcli", "responses"), nil
+}
+
+// CachingClient wraps c, a client for server, in a client that caches the
+// responses of the supervisor to username on disk, see
+// client.CachingClient. If username is empty the user of the supervisor
+// context is assumed. c is returned as is with --no-cache.
+func CachingClient(c client.Client, server, username string, onStale client.StaleFunc) (client.Client, error) {
+	if viper.GetBool("no-cache") {
+		return c, nil
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server URL: %w", err)
+	}
+	if len(username) == 0 {
+		conf, err := LoadKubeconfig()
+		if err != nil {
+			return nil, err
+		}
+		if ctx, ok := conf.Contexts[u.Host]; ok {
+			_, username, _ = ParseAuthInfoName(ctx.AuthInfo)
+		}
+	}
+	dir, err := ResponseCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, unsafeFileChars.ReplaceAllString(u.Host+"_"+username, "-"))
+	return client.NewCachingClient(c, dir, client.WithStaleFunc(onStale)), nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ErrMalformedToken is returned by ParseToken when the token isn't a JWT
+var ErrMalformedToken = errors.New("token is not a valid JWT")
+
+// TokenInfo holds the claims of a WCP session token that are of interest to
+// tcli. The token signature is not verified, tcli only uses it to tell when a
+// token is about to expire.
+type TokenInfo struct {
+	Subject   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ParseToken decodes the claims of a JWT session token
+func ParseToken(token string) (*TokenInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	var claims struct {
+		Subject   string `json:"sub"`
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	info := &TokenInfo{Subject: claims.Subject}
+	if claims.IssuedAt > 0 {
+		info.IssuedAt = time.Unix(claims.IssuedAt, 0)
+	}
+	if claims.ExpiresAt > 0 {
+		info.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	return info, nil
+}
+
+// Expired reports whether the token has expired at the given time. Tokens
+// without an expiry never expire.
+func (t *TokenInfo) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// Remaining returns the lifetime left of the token at the given time. The
+// result is negative if the token has expired.
+func (t *TokenInfo) Remaining(now time.Time) time.Duration {
+	return t.ExpiresAt.Sub(now)
+}
+
+// ManagedContext is a kubeconfig context written by "tcli login". tcli names
+// the authinfo of such contexts wcp:HOST:USERNAME, where HOST is the
+// supervisor or guest cluster host.
+type ManagedContext struct {
+	// Name of the context
+	Name string
+	// Host the authinfo was issued for
+	Host string
+	// Username that logged in
+	Username string
+	// Server is the API server URL of the context cluster
+	Server string
+	// Namespace of the context
+	Namespace string
+	// Supervisor is true for supervisor contexts and false for guest clusters
+	Supervisor bool
+	// Current is true if this is the current context of the kubeconfig
+	Current bool
+
+	Context  *clientcmdapi.Context
+	AuthInfo *clientcmdapi.AuthInfo
+}
+
+// ParseAuthInfoName splits an authinfo name written by "tcli login" into its
+// host and username. ok is false if the name wasn't written by tcli.
+func ParseAuthInfoName(name string) (host, username string, ok bool) {
+	rest, found := strings.CutPrefix(name, "wcp:")
+	if !found {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, ":")
+	if i <= 0 || i == len(rest)-1 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// ManagedContexts returns all contexts in conf that were written by
+// "tcli login", sorted by name
+func ManagedContexts(conf *clientcmdapi.Config) []ManagedContext {
+	var res []ManagedContext
+	for name, ctx := range conf.Contexts {
+		host, username, ok := ParseAuthInfoName(ctx.AuthInfo)
+		if !ok {
+			continue
+		}
+		mc := ManagedContext{
+			Name:       name,
+			Host:       host,
+			Username:   username,
+			Namespace:  ctx.Namespace,
+			Supervisor: name == host,
+			Current:    name == conf.CurrentContext,
+			Context:    ctx,
+			AuthInfo:   conf.AuthInfos[ctx.AuthInfo],
+		}
+		if cluster, ok := conf.Clusters[ctx.Cluster]; ok {
+			mc.Server = cluster.Server
+		}
+		res = append(res, mc)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
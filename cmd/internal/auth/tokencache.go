@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// tokenExpiryMargin is how long before its expiry a cached token is
+// considered stale, so that it doesn't expire while kubectl is using it
+const tokenExpiryMargin = time.Minute
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// TokenCacheDir returns the directory where session tokens used by the exec
+// credential plugin are cached
+func TokenCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tcli", "tokens"), nil
+}
+
+// tokenCachePath returns the file caching the token of username for the
+// given supervisor host and guest cluster. cluster is empty for supervisor
+// tokens.
+func tokenCachePath(host, username, namespace, cluster string) (string, error) {
+	dir, err := TokenCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := host + "_" + username
+	if len(cluster) > 0 {
+		name += "_" + namespace + "_" + cluster
+	}
+	return filepath.Join(dir, unsafeFileChars.ReplaceAllString(name, "-")), nil
+}
+
+// CachedToken returns the cached session token for the given supervisor host,
+// user and guest cluster. An empty string is returned if there is no cached
+// token or if it is about to expire.
+func CachedToken(host, username, namespace, cluster string) (string, error) {
+	token, err := readCachedToken(host, username, namespace, cluster)
+	if err != nil || len(token) == 0 {
+		return "", err
+	}
+	info, err := ParseToken(token)
+	if err != nil || info.Expired(time.Now().Add(tokenExpiryMargin)) {
+		return "", nil
+	}
+	return token, nil
+}
+
+// readCachedToken returns the cached session token regardless of whether it
+// has expired
+func readCachedToken(host, username, namespace, cluster string) (string, error) {
+	path, err := tokenCachePath(host, username, namespace, cluster)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading cached token: %w", err)
+	}
+	return string(b), nil
+}
+
+// StoreToken caches the session token for the given supervisor host, user
+// and guest cluster
+func StoreToken(host, username, namespace, cluster, token string) error {
+	path, err := tokenCachePath(host, username, namespace, cluster)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating token cache: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token), 0o600); err != nil {
+		return fmt.Errorf("caching token: %w", err)
+	}
+	return nil
+}
+
+// DeleteToken removes a cached session token, if any
+func DeleteToken(host, username, namespace, cluster string) error {
+	path, err := tokenCachePath(host, username, namespace, cluster)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package completion implements shell completion of the namespaces and guest
+// clusters on the supervisor, and of the contexts written by "tcli login".
+// The supervisor is asked using the session token stored in the kubeconfig,
+// and for namespaces the password if a source without side effects has it,
+// see auth.Passive. tcli never logs in or prompts while completing. The
+// answers of the supervisor are cached like those shown by "tcli list", so
+// that completion stays fast.
+package completion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// timeout is how long completion waits for the supervisor at most, however
+// long --timeout is
+const timeout = 5 * time.Second
+
+// supervisor is the supervisor that completions are fetched from
+type supervisor struct {
+	client   client.Client
+	server   string
+	username string
+	opts     []client.Option
+	// namespace is the namespace of the supervisor context
+	namespace string
+}
+
+// setup applies the flags and the profile. Completion functions are called
+// without running the hooks of the command, which otherwise do so.
+func setup(cmd *cobra.Command) error {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+	auth.DisablePrompts()
+	return auth.ApplyProfile()
+}
+
+// connect returns a client for the supervisor given by --server, or else the
+// one the current context was logged in to
+func connect(cmd *cobra.Command) (*supervisor, error) {
+	if err := setup(cmd); err != nil {
+		return nil, err
+	}
+
+	conf, err := auth.LoadKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	server, username := viper.GetString("server"), viper.GetString("username")
+	if len(server) == 0 {
+		if ctx, ok := conf.Contexts[conf.CurrentContext]; ok {
+			if info, ok := auth.GetContextInfo(ctx, conf.AuthInfos[ctx.AuthInfo]); ok {
+				server = info.Server
+			}
+		}
+	}
+	if len(server) == 0 {
+		return nil, errors.New("unknown supervisor")
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server URL: %w", err)
+	}
+
+	_, namespace, err := auth.TokenFromConfig(conf, u.Host, username)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := auth.ClientOptions(server)
+	if err != nil {
+		return nil, err
+	}
+	c, err := auth.TokenClient(server, username, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if c, err = auth.CachingClient(c, server, username, stale); err != nil {
+		return nil, err
+	}
+	return &supervisor{client: c, server: server, username: username, opts: opts, namespace: namespace}, nil
+}
+
+func (s *supervisor) namespaces() ([]string, error) {
+	// Namespaces are listed with the password, which is only used if it is
+	// available without prompting, reading stdin or running a command
+	c, err := auth.NamespacesClient(s.server, s.username, auth.Passive, s.opts...)
+	if err != nil {
+		return nil, err
+	}
+	if c, err = auth.CachingClient(c, s.server, s.username, stale); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout())
+	defer cancel()
+	ns, err := c.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(ns))
+	for _, n := range ns {
+		names = append(names, n.Namespace)
+	}
+	return names, nil
+}
+
+func (s *supervisor) clusters(namespace string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout())
+	defer cancel()
+	list, err := s.client.ClusterList(ctx, namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, tkc := range list.Items {
+		names = append(names, tkc.Name)
+	}
+	return names, nil
+}
+
+// stale logs to the completion debug log that cached completions are used
+// because the supervisor can't be reached
+func stale(what string, age time.Duration, err error) {
+	cobra.CompDebugln(fmt.Sprintf("supervisor unreachable, completing %s cached %s ago: %v", what, age, err), true)
+}
+
+func completionTimeout() time.Duration {
+	if t := viper.GetDuration("timeout"); t > 0 && t < timeout {
+		return t
+	}
+	return timeout
+}
+
+// Namespaces completes the namespaces on the supervisor
+func Namespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	s, err := connect(cmd)
+	if err != nil {
+		return fail(err)
+	}
+	names, err := s.namespaces()
+	if err != nil {
+		return fail(err)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// Clusters returns a function completing the guest clusters in the namespace
+// given by --namespace. Without it, the clusters in every namespace are
+// completed if allNamespaces is true, and else the clusters in the namespace
+// of the supervisor context. Clusters already given are left out, and
+// nothing is completed once the command takes no more arguments.
+func Clusters(allNamespaces bool) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if cmd.Args != nil && cmd.Args(cmd, append(args[:len(args):len(args)], toComplete)) != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		s, err := connect(cmd)
+		if err != nil {
+			return fail(err)
+		}
+
+		namespaces := []string{viper.GetString("namespace")}
+		if len(namespaces[0]) == 0 {
+			if allNamespaces {
+				if namespaces, err = s.namespaces(); err != nil {
+					return fail(err)
+				}
+			} else {
+				namespaces[0] = s.namespace
+			}
+		}
+
+		given := map[string]bool{}
+		for _, a := range args {
+			given[a] = true
+		}
+		var names []string
+		for _, ns := range namespaces {
+			clusters, err := s.clusters(ns)
+			if err != nil {
+				return fail(err)
+			}
+			for _, name := range clusters {
+				if !given[name] {
+					names = append(names, name)
+				}
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// Contexts completes the names of the contexts written by "tcli login", and
+// the names of the guest clusters they were logged in to
+func Contexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := setup(cmd); err != nil {
+		return fail(err)
+	}
+	conf, err := auth.LoadKubeconfig()
+	if err != nil {
+		return fail(err)
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, mc := range auth.ManagedContexts(conf) {
+		candidates := []string{mc.Name}
+		if info, ok := mc.Info(); ok && len(info.Cluster) > 0 {
+			candidates = append(candidates, info.Cluster)
+		}
+		for _, name := range candidates {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// fail logs err to the completion debug log, and completes nothing
+func fail(err error) ([]string, cobra.ShellCompDirective) {
+	cobra.CompDebugln(err.Error(), true)
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
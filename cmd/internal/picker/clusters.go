@@ -0,0 +1,73 @@
+package picker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+)
+
+// Cluster is a guest cluster chosen with the picker
+type Cluster struct {
+	Namespace string
+	Name      string
+}
+
+// Clusters lets the user choose among the clusters in namespaces, which are
+// listed with c. If multi is true several clusters may be chosen.
+func Clusters(ctx context.Context, c client.Client, namespaces []string, multi bool) ([]Cluster, error) {
+	var (
+		clusters []Cluster
+		labels   []string
+	)
+	for _, ns := range namespaces {
+		list, err := c.ClusterList(ctx, ns, "")
+		if err != nil {
+			return nil, fmt.Errorf("listing clusters in namespace %q: %w", ns, err)
+		}
+		for _, tkc := range list.Items {
+			clusters = append(clusters, Cluster{Namespace: ns, Name: tkc.Name})
+			labels = append(labels, ns+"/"+tkc.Name)
+		}
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters found")
+	}
+
+	if !multi {
+		i, err := Pick("Cluster", labels)
+		if err != nil {
+			return nil, err
+		}
+		return []Cluster{clusters[i]}, nil
+	}
+	chosen, err := PickMany("Clusters", labels)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Cluster, 0, len(chosen))
+	for _, i := range chosen {
+		res = append(res, clusters[i])
+	}
+	return res, nil
+}
+
+// Namespace lets the user choose among the namespaces available to the user
+func Namespace(ctx context.Context, c client.Client) (string, error) {
+	ns, err := c.Namespaces(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ns) == 0 {
+		return "", fmt.Errorf("no namespaces found")
+	}
+	names := make([]string, 0, len(ns))
+	for _, n := range ns {
+		names = append(names, n.Namespace)
+	}
+	i, err := Pick("Namespace", names)
+	if err != nil {
+		return "", err
+	}
+	return names[i], nil
+}
@@ -0,0 +1,314 @@
+// Package picker implements a keyboard driven fuzzy search picker for the
+// terminal, used to choose clusters and namespaces instead of typing their
+// names.
+package picker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ErrAborted is returned when the user cancels the picker
+var ErrAborted = errors.New("selection aborted")
+
+// maxRows is the maximum number of items shown at once
+const maxRows = 10
+
+// Available reports whether a picker can be shown, which requires both stdin
+// and stderr to be terminals
+func Available() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// Pick lets the user choose one of items and returns its index
+func Pick(prompt string, items []string) (int, error) {
+	res, err := run(prompt, items, false)
+	if err != nil {
+		return -1, err
+	}
+	return res[0], nil
+}
+
+// PickMany lets the user choose any number of items and returns their
+// indices in the order of items. If the user doesn't select any item, the
+// item under the cursor is chosen.
+func PickMany(prompt string, items []string) ([]int, error) {
+	return run(prompt, items, true)
+}
+
+func run(prompt string, items []string, multi bool) ([]int, error) {
+	if len(items) == 0 {
+		return nil, errors.New("nothing to choose from")
+	}
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("setting terminal to raw mode: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+
+	m := newModel(prompt, items, multi, width)
+	defer m.clear(os.Stderr)
+
+	buf := make([]byte, 64)
+	for {
+		m.render(os.Stderr)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		done, err := m.handle(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return m.result(), nil
+		}
+	}
+}
+
+// match is an item matching the query
+type match struct {
+	index int
+	score int
+}
+
+// model is the state of the picker
+type model struct {
+	prompt   string
+	items    []string
+	multi    bool
+	width    int
+	query    []rune
+	matches  []match
+	cursor   int
+	offset   int
+	selected map[int]bool
+}
+
+func newModel(prompt string, items []string, multi bool, width int) *model {
+	m := &model{prompt: prompt, items: items, multi: multi, width: width, selected: map[int]bool{}}
+	m.filter()
+	return m
+}
+
+// filter updates the matches after the query has changed
+func (m *model) filter() {
+	m.matches = m.matches[:0]
+	query := strings.ToLower(string(m.query))
+	for i, item := range m.items {
+		if score, ok := fuzzyScore(strings.ToLower(item), query); ok {
+			m.matches = append(m.matches, match{index: i, score: score})
+		}
+	}
+	sort.SliceStable(m.matches, func(i, j int) bool {
+		return m.matches[i].score > m.matches[j].score
+	})
+	m.cursor, m.offset = 0, 0
+}
+
+// fuzzyScore reports whether all runes of query appear in s in order, and
+// scores the match. Consecutive runes and runes at the start of a word score
+// higher, so that "pay prod" style queries rank "team-payments-prod" first.
+func fuzzyScore(s, query string) (int, bool) {
+	score, last := 0, -2
+	runes := []rune(s)
+	pos := 0
+	for _, q := range query {
+		if unicode.IsSpace(q) {
+			continue
+		}
+		found := false
+		for ; pos < len(runes); pos++ {
+			if runes[pos] != q {
+				continue
+			}
+			score++
+			if pos == last+1 {
+				score += 5
+			}
+			if pos == 0 || strings.ContainsRune("-_./: ", runes[pos-1]) {
+				score += 3
+			}
+			last = pos
+			pos++
+			found = true
+			break
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// handle processes a chunk of input and reports whether the user confirmed
+// the selection. A chunk may contain several keys when input is pasted or
+// typed quickly.
+func (m *model) handle(input []byte) (bool, error) {
+	for _, key := range splitKeys(string(input)) {
+		done, err := m.key(key)
+		if done || err != nil {
+			return done, err
+		}
+	}
+	return false, nil
+}
+
+// splitKeys splits input into keys, keeping escape sequences together. A
+// byte which doesn't start a valid UTF-8 sequence is a key of its own.
+func splitKeys(input string) []string {
+	var keys []string
+	for len(input) > 0 {
+		_, n := utf8.DecodeRuneInString(input)
+		if input[0] == '\x1b' && len(input) >= 3 && (input[1] == '[' || input[1] == 'O') {
+			n = 2
+			for n < len(input) && (input[n] < 0x40 || input[n] > 0x7e) {
+				n++
+			}
+			if n < len(input) {
+				n++
+			}
+		}
+		keys = append(keys, input[:n])
+		input = input[n:]
+	}
+	return keys
+}
+
+// key processes a single key and reports whether the user confirmed the
+// selection
+func (m *model) key(k string) (bool, error) {
+	switch k {
+	case "\x03", "\x1b", "\x04":
+		return false, ErrAborted
+	case "\r", "\n":
+		return len(m.matches) > 0 || len(m.selected) > 0, nil
+	case "\x1b[A", "\x1bOA", "\x10":
+		m.move(-1)
+	case "\x1b[B", "\x1bOB", "\x0e":
+		m.move(1)
+	case "\t", " ":
+		if m.multi && len(m.matches) > 0 {
+			i := m.matches[m.cursor].index
+			m.selected[i] = !m.selected[i]
+			if !m.selected[i] {
+				delete(m.selected, i)
+			}
+			m.move(1)
+		}
+	case "\x7f", "\x08":
+		if len(m.query) > 0 {
+			m.query = m.query[:len(m.query)-1]
+			m.filter()
+		}
+	case "\x15":
+		m.query = m.query[:0]
+		m.filter()
+	default:
+		r := []rune(k)
+		if len(r) == 1 && r[0] != utf8.RuneError && unicode.IsPrint(r[0]) {
+			m.query = append(m.query, r[0])
+			m.filter()
+		}
+	}
+	return false, nil
+}
+
+// move moves the cursor by delta, scrolling the visible items as needed
+func (m *model) move(delta int) {
+	if len(m.matches) == 0 {
+		return
+	}
+	m.cursor = (m.cursor + delta + len(m.matches)) % len(m.matches)
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+maxRows {
+		m.offset = m.cursor - maxRows + 1
+	}
+}
+
+// result returns the indices of the chosen items
+func (m *model) result() []int {
+	if len(m.selected) == 0 {
+		return []int{m.matches[m.cursor].index}
+	}
+	res := make([]int, 0, len(m.selected))
+	for i := range m.items {
+		if m.selected[i] {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// render draws the prompt and the visible matches below it, leaving the
+// cursor at the end of the query
+func (m *model) render(w io.Writer) {
+	var b strings.Builder
+	b.WriteString("\r\x1b[J")
+	prompt := fmt.Sprintf("%s> %s", m.prompt, string(m.query))
+
+	lines := 0
+	end := m.offset + maxRows
+	if end > len(m.matches) {
+		end = len(m.matches)
+	}
+	for i := m.offset; i < end; i++ {
+		idx := m.matches[i].index
+		line := "  "
+		if i == m.cursor {
+			line = "> "
+		}
+		if m.multi {
+			if m.selected[idx] {
+				line += "[x] "
+			} else {
+				line += "[ ] "
+			}
+		}
+		line = truncate(line+m.items[idx], m.width-1)
+		if i == m.cursor {
+			line = "\x1b[1m" + line + "\x1b[0m"
+		}
+		b.WriteString("\r\n" + line)
+		lines++
+	}
+
+	help := "↑/↓ move, enter confirm, esc cancel"
+	if m.multi {
+		help = "↑/↓ move, tab select, enter confirm, esc cancel"
+	}
+	fmt.Fprintf(&b, "\r\n\x1b[2m  %d/%d  %s\x1b[0m", len(m.matches), len(m.items), truncate(help, m.width-14))
+	lines++
+
+	fmt.Fprintf(&b, "\x1b[%dA\r%s", lines, truncate(prompt, m.width-1))
+	_, _ = io.WriteString(w, b.String())
+}
+
+// clear removes the picker from the terminal
+func (m *model) clear(w io.Writer) {
+	_, _ = io.WriteString(w, "\r\x1b[J")
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if width <= 1 || len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
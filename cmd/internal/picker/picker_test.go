@@ -0,0 +1,92 @@
+package picker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"plain", "ab", []string{"a", "b"}},
+		{"arrow keys", "\x1b[A\x1b[B", []string{"\x1b[A", "\x1b[B"}},
+		{"application mode arrow", "\x1bOAx", []string{"\x1bOA", "x"}},
+		{"sequence with parameters", "\x1b[1;5Cz", []string{"\x1b[1;5C", "z"}},
+		{"lone escape", "\x1b", []string{"\x1b"}},
+		{"escape and letter", "\x1bq", []string{"\x1b", "q"}},
+		{"multibyte runes", "åö€", []string{"å", "ö", "€"}},
+		{"truncated rune", "a\xe2\x82", []string{"a", "\xe2", "\x82"}},
+		{"high-bit byte", "\xff", []string{"\xff"}},
+		{"truncated sequence", "\x1b[1;", []string{"\x1b[1;"}},
+		{"enter after text", "web\r", []string{"w", "e", "b", "\r"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitKeys(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitKeys(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	items := []string{"team-a/payments-dev", "team-b/payments-prod", "team-b/api"}
+	m := newModel("Cluster", items, false, 80)
+	if _, err := m.handle([]byte("pay prod")); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.matches) != 1 || items[m.matches[0].index] != "team-b/payments-prod" {
+		t.Errorf("query %q matched %v", string(m.query), m.matches)
+	}
+
+	if _, ok := fuzzyScore("team-b/api", "zz"); ok {
+		t.Error("query with runes missing from the item matched")
+	}
+	start, _ := fuzzyScore("prod-web", "pw")
+	middle, _ := fuzzyScore("xpxxwx", "pw")
+	if start <= middle {
+		t.Errorf("match at word starts scored %d, not more than %d", start, middle)
+	}
+}
+
+func TestModelKeys(t *testing.T) {
+	items := []string{"team-a/web", "team-a/db", "team-b/api"}
+
+	m := newModel("Cluster", items, false, 80)
+	done, err := m.handle([]byte("\x1b[B\r"))
+	if err != nil || !done {
+		t.Fatalf("enter: done %v, err %v", done, err)
+	}
+	if got := m.result(); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("picked %v, want [1]", got)
+	}
+
+	m = newModel("Clusters", items, true, 80)
+	if _, err := m.handle([]byte("\t\x1b[B\t")); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.result(); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("selected %v, want [0 2]", got)
+	}
+
+	// Bytes which aren't valid UTF-8 are ignored
+	m = newModel("Cluster", items, false, 80)
+	if _, err := m.handle([]byte("ap\xe2")); err != nil {
+		t.Fatal(err)
+	}
+	if string(m.query) != "ap" {
+		t.Errorf("query is %q, want %q", string(m.query), "ap")
+	}
+
+	m = newModel("Cluster", items, false, 80)
+	if _, err := m.handle([]byte("zz\r")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.handle([]byte("\x03")); !errors.Is(err, ErrAborted) {
+		t.Errorf("ctrl-c: got %v, want ErrAborted", err)
+	}
+}
@@ -0,0 +1,114 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/spf13/cobra"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+func NewCmdKubeconfig() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Manage backups of the kubeconfig",
+		Long: `Manage backups of the kubeconfig
+
+Every time tcli changes the kubeconfig, for example when logging in or out or
+switching namespace, the kubeconfig files are backed up first. The most recent
+backups are kept in ~/.config/tcli/kubeconfig-backups, as many as given by
+--kubeconfig-backups.
+
+Examples:
+	# List the backups, most recent first
+	tcli kubeconfig backups
+
+	# Undo the last change tcli made to the kubeconfig
+	tcli kubeconfig restore
+
+	# Restore a specific backup
+	tcli kubeconfig restore 20240131T101500.000Z
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+	}
+	c.AddCommand(newCmdBackups())
+	c.AddCommand(newCmdRestore())
+	return c
+}
+
+func newCmdBackups() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backups",
+		Args:  cobra.NoArgs,
+		Short: "List the kubeconfig backups, most recent first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backups, err := auth.KubeconfigStore().Backups()
+			if err != nil {
+				return fmt.Errorf("listing backups: %w", err)
+			}
+			if len(backups) == 0 {
+				fmt.Println("No backups found")
+				return nil
+			}
+
+			now := time.Now()
+			table := &v1.Table{
+				ColumnDefinitions: []v1.TableColumnDefinition{
+					{Name: "ID", Type: "string"},
+					{Name: "CREATED", Type: "string"},
+					{Name: "AGE", Type: "string"},
+					{Name: "FILES", Type: "string"},
+				},
+			}
+			for _, b := range backups {
+				files := make([]string, 0, len(b.Files))
+				for _, f := range b.Files {
+					files = append(files, f.Path)
+				}
+				table.Rows = append(table.Rows, v1.TableRow{
+					Cells: []interface{}{
+						b.ID,
+						b.Created.Local().Format("2006-01-02 15:04:05"),
+						duration.HumanDuration(now.Sub(b.Created)),
+						strings.Join(files, ","),
+					},
+				})
+			}
+			printer := printers.NewTablePrinter(printers.PrintOptions{})
+			return printer.PrintObj(table, os.Stdout)
+		},
+	}
+}
+
+func newCmdRestore() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore [ID]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Restore the kubeconfig from a backup, the most recent one if no ID is given",
+		Long: `Restore the kubeconfig from a backup, the most recent one if no ID is given
+
+The current kubeconfig is backed up before it is replaced, so a restore can be
+undone by running "tcli kubeconfig restore" again.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var id string
+			if len(args) > 0 {
+				id = args[0]
+			}
+			b, err := auth.KubeconfigStore().Restore(id)
+			if err != nil {
+				return fmt.Errorf("restoring kubeconfig: %w", err)
+			}
+			for _, f := range b.Files {
+				fmt.Printf("Restored %s from backup %s\n", f.Path, b.ID)
+			}
+			return nil
+		},
+	}
+}
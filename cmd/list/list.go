@@ -3,25 +3,33 @@ package list
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/cmd/internal/completion"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/cli-runtime/pkg/printers"
 
 	"github.com/middlewaregruppen/tcli/pkg/client"
 )
 
-var tanzuNamespace string
+var (
+	tanzuNamespace string
+	noCache        bool
+)
 
 func NewCmdList() *cobra.Command {
 	c := &cobra.Command{
-		Use:     "list RESOURCE",
-		Aliases: []string{"ls"},
-		Args:    cobra.ExactArgs(1),
-		Short:   "List clusters and namespaces",
+		Use:       "list RESOURCE",
+		Aliases:   []string{"ls"},
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"namespaces", "clusters", "releases", "addons"},
+		Short:     "List clusters and namespaces",
 		Long: `List clusters and namespaces
 Examples:
 	# List namespaces
@@ -36,6 +44,11 @@ Examples:
 	# List addons
 	tcli list addons
 
+	# Namespaces, clusters and releases are cached for a minute, and the
+	# cached lists are shown when the supervisor can't be reached. Always
+	# ask the supervisor
+	tcli list clusters --no-cache
+
 	Use "tcli --help" for a list of global command-line options (applies to all commands).
 	`,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -47,23 +60,30 @@ Examples:
 
 			tanzuServer := viper.GetString("server")
 			tanzuUsername := viper.GetString("username")
-			tanzuPassword := viper.GetString("password")
-			insecureSkipVerify := viper.GetBool("insecure")
-			kubeconfig := viper.GetString("kubeconfig")
 
-			c, contextNamespace, err := auth.ClientFromKubeconfig(tanzuServer, kubeconfig, tanzuUsername, insecureSkipVerify)
+			opts, err := auth.ClientOptions(tanzuServer)
+			if err != nil {
+				return err
+			}
+
+			c, contextNamespace, err := auth.ClientFromKubeconfig(tanzuServer, tanzuUsername, opts...)
+			if err != nil {
+				return err
+			}
+			c, err = auth.CachingClient(c, tanzuServer, tanzuUsername, warnStale)
 			if err != nil {
 				return err
 			}
 
 			// If --namespace was not given, fall back to the namespace stored in the kubeconfig context
+			tanzuNamespace := viper.GetString("namespace")
 			if len(tanzuNamespace) == 0 {
 				tanzuNamespace = contextNamespace
 			}
 
 			switch strings.ToLower(args[0]) {
 			case "namespaces", "ns":
-				return listNamespaces(ctx, tanzuServer, tanzuUsername, tanzuPassword, insecureSkipVerify)
+				return listNamespaces(ctx, tanzuServer, tanzuUsername, opts...)
 			case "clusters", "clu", "tkc":
 				return listClusters(ctx, c, tanzuNamespace)
 			case "releases", "rel", "tkr":
@@ -76,6 +96,8 @@ Examples:
 		},
 	}
 	c.Flags().StringVarP(&tanzuNamespace, "namespace", "n", "", "Namespace in which the Tanzu Kubernetes cluster resides.")
+	_ = c.RegisterFlagCompletionFunc("namespace", completion.Namespaces)
+	c.Flags().BoolVar(&noCache, "no-cache", false, "Always ask the supervisor, rather than using or updating the cached lists.")
 	return c
 }
 
@@ -97,8 +119,12 @@ func listReleases(ctx context.Context, c client.Client) error {
 	return printer.PrintObj(objs, os.Stdout)
 }
 
-func listNamespaces(ctx context.Context, server, username, password string, insecure bool) error {
-	c, err := client.New(server, client.WithCredentials(client.BasicCredentials(username, password)), client.WithInsecure(insecure))
+func listNamespaces(ctx context.Context, server, username string, opts ...client.Option) error {
+	c, err := auth.NamespacesClient(server, username, auth.Interactive, opts...)
+	if err != nil {
+		return err
+	}
+	c, err = auth.CachingClient(c, server, username, warnStale)
 	if err != nil {
 		return err
 	}
@@ -121,3 +147,10 @@ func listAddons(ctx context.Context, c client.Client) error {
 	printer := printers.NewTablePrinter(printers.PrintOptions{})
 	return printer.PrintObj(objs, os.Stdout)
 }
+
+// warnStale tells the user that the supervisor can't be reached, and that
+// what is shown was cached age ago
+func warnStale(what string, age time.Duration, err error) {
+	slog.Debug("supervisor unreachable, using cached response", "error", err)
+	fmt.Fprintf(os.Stderr, "Warning: the supervisor can't be reached, showing %s as cached %s ago\n", what, duration.HumanDuration(age))
+}
@@ -5,29 +5,69 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"log/slog"
+	"io"
 	"net/url"
-	"syscall"
-
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/cmd/internal/completion"
+	"github.com/middlewaregruppen/tcli/cmd/internal/picker"
 	"github.com/middlewaregruppen/tcli/pkg/client"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/term"
 
-	"k8s.io/client-go/tools/clientcmd"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/client-go/tools/clientcmd/api"
 )
 
 var (
 	tanzuNamespace string
 	silent         bool
+	execCredential bool
+	allClusters    bool
+	allNamespaces  bool
+	selector       string
+	concurrency    int
+	pick           bool
+	outputDir      string
+	split          bool
+	contextName    string
 )
 
+// defaultContextName is the template naming guest cluster contexts by default
+const defaultContextName = "{{.Cluster}}"
+
+// clusterRef identifies a guest cluster to log in to
+type clusterRef struct {
+	namespace string
+	name      string
+	// context is the name of the kubeconfig context of the cluster
+	context string
+}
+
+// contextNameData is what --context-name templates are executed with
+type contextNameData struct {
+	// Server is the URL of the supervisor
+	Server string
+	// Host is the host of the supervisor, including the port if given
+	Host      string
+	Namespace string
+	Cluster   string
+	User      string
+}
+
 func NewCmdLogin() *cobra.Command {
 	c := &cobra.Command{
 		Use:   "login [CLUSTER...]",
 		Args:  cobra.MinimumNArgs(0),
 		Short: "Authenticate user with Tanzu namespaces and clusters",
+		// Without --namespace the cluster is looked for in every namespace
+		ValidArgsFunction: completion.Clusters(true),
 		Long: `Authenticate user with Tanzu namespaces and clusters
 Examples:
 	# Login to the supervisor cluster
@@ -39,15 +79,47 @@ Examples:
 	export TCLI_PASSWORD=mypassword
 	tcli login
 
+	# Read the password from stdin, a file or a password manager instead
+	echo "$PASSWORD" | tcli login --password-stdin
+	tcli login --password-file ~/.vsphere-password
+	tcli login --password-command "pass show vsphere/bob"
+
 	# Login to a tanzu cluster
 	tcli login CLUSTER
 
-	# Login to multiple tanzu clusters in one go
+	# Login to multiple tanzu clusters in one go. Clusters are logged in to
+	# concurrently, and every successful login is kept even if others fail
 	tcli login CLUSTER1 CLUSTER2 CLUSTER3 ...
 
 	# Login to tanzu clusters in the same namespace
 	tcli login CLUSTER1 CLUSTER2 -n NAMESPACE
 
+	# Login to every tanzu cluster in a namespace, or in all namespaces
+	tcli login --all -n NAMESPACE
+	tcli login -A
+
+	# Login to every tanzu cluster with matching labels
+	tcli login -A -l env=prod
+
+	# Choose the tanzu clusters to login to from a list
+	tcli login --pick
+
+	# Connect through a SOCKS proxy, which kubectl will use as well
+	tcli login CLUSTER --proxy socks5://localhost:1080
+
+	# Name the cluster contexts after both namespace and cluster, so that
+	# clusters with the same name in different namespaces don't collide
+	tcli login -A --context-name '{{.Namespace}}/{{.Cluster}}'
+
+	# Write the supervisor and each cluster to a kubeconfig file of its own
+	# in ~/.kube/tcli, and use one of them
+	tcli login CLUSTER --split
+	export KUBECONFIG=~/.kube/tcli/CLUSTER.yaml
+
+	# Let kubectl obtain tokens by running "tcli credential" instead of
+	# storing them in the kubeconfig, so that expired tokens are renewed
+	tcli login CLUSTER --exec-credential
+
 	Use "tcli --help" for a list of global command-line options (applies to all commands).
 	`,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -55,19 +127,29 @@ Examples:
 				return err
 			}
 
-			// Prompt for password on stdin if it wasn't provided via flag or env
-			if len(viper.GetString("password")) == 0 {
-				fmt.Printf("Password:")
-				bytePassword, err := term.ReadPassword(int(syscall.Stdin))
-				if err != nil {
-					return err
-				}
-				if err := cmd.Flags().Set("password", string(bytePassword)); err != nil {
-					return err
-				}
-				fmt.Printf("\n")
+			if (allClusters || allNamespaces || len(selector) > 0 || pick) && len(args) > 0 {
+				return errors.New("clusters can't be given together with --all, --all-namespaces, --selector or --pick")
 			}
-			return nil
+			if pick && !picker.Available() {
+				return errors.New("--pick requires a terminal")
+			}
+			if _, err := parseContextName(viper.GetString("context-name")); err != nil {
+				return err
+			}
+			if _, err := labels.Parse(selector); err != nil {
+				return fmt.Errorf("invalid label selector: %w", err)
+			}
+			if (allClusters || len(selector) > 0) && !allNamespaces && len(viper.GetString("namespace")) == 0 {
+				return errors.New("--all and --selector require --namespace, use --all-namespaces to log in to clusters in every namespace")
+			}
+
+			// Resolve the password from the credential sources, prompting
+			// for it as a last resort
+			password, err := auth.ResolvePassword(viper.GetString("server"), viper.GetString("username"), auth.Interactive)
+			if err != nil {
+				return err
+			}
+			return cmd.Flags().Set("password", password)
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
@@ -78,7 +160,10 @@ Examples:
 			tanzuPassword := viper.GetString("password")
 			tanzuNamespace := viper.GetString("namespace")
 			insecureSkipVerify := viper.GetBool("insecure")
-			kubeconfig := viper.GetString("kubeconfig")
+			outputDir := viper.GetString("output-dir")
+			if split && len(outputDir) == 0 {
+				outputDir = auth.SplitDir
+			}
 
 			u, err := url.Parse(tanzuServer)
 			if err != nil {
@@ -91,11 +176,14 @@ Examples:
 			// the port if the user supplied tanzuServer with an explicit port.
 			supervisorK8sServer := fmt.Sprintf("https://%s:6443", u.Hostname())
 
+			opts, err := auth.ClientOptions(tanzuServer)
+			if err != nil {
+				return err
+			}
+
 			c, err := client.New(
 				tanzuServer,
-				client.WithLogger(slog.Default()),
-				client.WithCredentials(client.BasicCredentials(tanzuUsername, tanzuPassword)),
-				client.WithInsecure(insecureSkipVerify),
+				append(opts, client.WithCredentials(client.BasicCredentials(tanzuUsername, tanzuPassword)))...,
 			)
 			if err != nil {
 				return err
@@ -111,29 +199,68 @@ Examples:
 				return err
 			}
 
-			// Build the supervisor cluster entry for kubeconfig
+			// Build the supervisor cluster entry for kubeconfig. When a CA
+			// bundle is given it is embedded so that kubectl can verify the
+			// supervisor certificate instead of skipping verification.
 			supervisorCluster := api.NewCluster()
 			supervisorCluster.InsecureSkipTLSVerify = insecureSkipVerify
 			supervisorCluster.Server = supervisorK8sServer
+			supervisorCluster.TLSServerName = viper.GetString("tls-server-name")
+			supervisorCluster.ProxyURL = viper.GetString("proxy")
+			caData, err := auth.CAData()
+			if err != nil {
+				return err
+			}
+			if len(caData) == 0 && !insecureSkipVerify {
+				// The supervisor serves the same certificate on the k8s
+				// API, so a certificate trusted on first use is trusted by
+				// kubectl as well
+				caData, err = auth.PinnedCA(tanzuServer)
+				if err != nil {
+					return err
+				}
+			}
+			if len(caData) > 0 {
+				supervisorCluster.CertificateAuthorityData = caData
+				supervisorCluster.InsecureSkipTLSVerify = false
+			}
 
 			authName := fmt.Sprintf("wcp:%s:%s", u.Host, tanzuUsername)
-			auth := api.NewAuthInfo()
-			auth.Token = sess.SessionID
+			authInfo := api.NewAuthInfo()
+			authInfo.Token = sess.SessionID
+			if execCredential {
+				authInfo, err = execAuthInfo(tanzuServer, u.Host, tanzuUsername, "", "", sess.SessionID)
+				if err != nil {
+					return err
+				}
+			}
 
 			kubectx := api.NewContext()
 			kubectx.Cluster = u.Host
 			kubectx.AuthInfo = authName
+			if err := auth.SetContextInfo(kubectx, auth.ContextInfo{Server: tanzuServer}); err != nil {
+				return err
+			}
 			if len(ns) > 0 {
 				kubectx.Namespace = ns[len(ns)-1].Namespace
 			}
 
-			// Load kubeconfig once; update in memory, write once at the end
-			conf, err := clientcmd.LoadFromFile(kubeconfig)
-			if err != nil {
-				return fmt.Errorf("loading kubeconfig: %w", err)
+			// Load kubeconfig once; update in memory, write once at the end.
+			// Each context gets a file of its own with --output-dir, so
+			// the kubeconfig isn't needed then.
+			conf := api.NewConfig()
+			if len(outputDir) == 0 {
+				conf, err = auth.LoadKubeconfig()
+				if err != nil {
+					return err
+				}
+			}
+			// The supervisor context is always named after the host
+			if err := checkContextOwner(conf, u.Host, auth.ContextInfo{Server: tanzuServer}, "rename it with 'kubectl config rename-context'"); err != nil {
+				return err
 			}
 			conf.Clusters[u.Host] = supervisorCluster
-			conf.AuthInfos[authName] = auth
+			conf.AuthInfos[authName] = authInfo
 			conf.Contexts[u.Host] = kubectx
 			conf.CurrentContext = u.Host
 
@@ -144,57 +271,329 @@ Examples:
 				}
 			}
 
-			// Login to each requested workload cluster, updating conf in memory
+			// The cluster APIs of the supervisor take the session token
+			// rather than the password
+			tokenClient, err := client.New(tanzuServer, append(opts, client.WithCredentials(client.TokenCredentials(sess.SessionID)))...)
+			if err != nil {
+				return err
+			}
+
+			// Clusters are listed in the namespace given by --namespace,
+			// or else in every namespace
+			namespaces := []string{tanzuNamespace}
+			if allNamespaces || len(tanzuNamespace) == 0 {
+				namespaces = namespaces[:0]
+				for _, n := range ns {
+					namespaces = append(namespaces, n.Namespace)
+				}
+			}
+
+			refs := make([]clusterRef, 0, len(args))
 			for _, tanzuCluster := range args {
-				res, err := c.LoginCluster(ctx, tanzuCluster, tanzuNamespace)
+				refs = append(refs, clusterRef{namespace: tanzuNamespace, name: tanzuCluster})
+			}
+			if allClusters || allNamespaces || len(selector) > 0 {
+				refs, err = listClusters(ctx, tokenClient, namespaces, selector)
 				if err != nil {
-					if errors.Is(err, client.ErrClusterNotFound) {
-						return fmt.Errorf("cluster %q not found", tanzuCluster)
-					}
 					return err
 				}
-
-				caCertData, err := base64.StdEncoding.DecodeString(res.GuestClusterCa)
+				if len(refs) == 0 && !silent {
+					fmt.Println("No clusters found")
+				}
+			}
+			if pick {
+				chosen, err := picker.Clusters(ctx, tokenClient, namespaces, true)
 				if err != nil {
-					return fmt.Errorf("decoding CA cert for cluster %q: %w", tanzuCluster, err)
+					return err
+				}
+				for _, cl := range chosen {
+					refs = append(refs, clusterRef{namespace: cl.Namespace, name: cl.Name})
 				}
 
-				wlCluster := api.NewCluster()
-				wlCluster.CertificateAuthorityData = caCertData
-				wlCluster.Server = fmt.Sprintf("https://%s:6443", res.GuestClusterServer)
-
-				wlAuthName := fmt.Sprintf("wcp:%s:%s", res.GuestClusterServer, tanzuUsername)
-				wlAuth := api.NewAuthInfo()
-				wlAuth.Token = res.SessionID
+				// The timeout starts over after the user has chosen
+				ctx, cancel = context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+				defer cancel()
+			}
 
-				wlCtx := api.NewContext()
-				wlCtx.Cluster = res.GuestClusterServer
-				wlCtx.AuthInfo = wlAuthName
+			if err := nameContexts(refs, viper.GetString("context-name"), tanzuServer, u.Host, tanzuUsername); err != nil {
+				return err
+			}
 
-				// Propagate the namespace into the supervisor context so that
-				// subsequent commands that read --namespace from kubeconfig work
-				// without requiring the flag explicitly.
-				if _, ok := conf.Contexts[u.Host]; ok {
-					conf.Contexts[u.Host].Namespace = tanzuNamespace
+			// Login to the workload clusters concurrently, then add every
+			// cluster that succeeded to conf in memory
+			results := loginClusters(ctx, c, refs, concurrency)
+			failed := 0
+			for i, ref := range refs {
+				if results[i].err == nil {
+					results[i].err = addCluster(conf, tanzuServer, u.Host, tanzuUsername, ref, results[i].res)
+				}
+				if results[i].err != nil {
+					failed++
 				}
-
-				conf.Clusters[res.GuestClusterServer] = wlCluster
-				conf.AuthInfos[wlAuthName] = wlAuth
-				conf.Contexts[tanzuCluster] = wlCtx
-				conf.CurrentContext = tanzuCluster
-
-				fmt.Printf("Successfully logged into cluster %s\n", tanzuCluster)
 			}
 
-			// Single write after all in-memory updates are done
-			if err := clientcmd.WriteToFile(*conf, kubeconfig); err != nil {
-				return fmt.Errorf("writing kubeconfig: %w", err)
+			// Single write after all in-memory updates are done, so that
+			// successful logins are kept even if others failed
+			if len(outputDir) > 0 {
+				contexts := []string{u.Host}
+				for i, ref := range refs {
+					if results[i].err == nil {
+						contexts = append(contexts, ref.context)
+					}
+				}
+				for _, name := range contexts {
+					path, err := auth.WriteSplit(conf, outputDir, name)
+					if err != nil {
+						return err
+					}
+					if !silent {
+						fmt.Printf("Wrote context %q to %s\n", name, path)
+					}
+				}
+			} else if err := auth.SaveKubeconfig(conf); err != nil {
+				return err
 			}
 
+			if len(refs) == 1 {
+				if results[0].err != nil {
+					return results[0].err
+				}
+				fmt.Printf("Successfully logged into cluster %s\n", refs[0].name)
+				return nil
+			}
+			if (!silent || failed > 0) && len(refs) > 0 {
+				if err := printSummary(refs, results); err != nil {
+					return err
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to login to %d of %d clusters", failed, len(refs))
+			}
 			return nil
 		},
 	}
 	c.Flags().StringVarP(&tanzuNamespace, "namespace", "n", "", "Namespace in which the Tanzu Kubernetes cluster resides.")
+	_ = c.RegisterFlagCompletionFunc("namespace", completion.Namespaces)
 	c.Flags().BoolVar(&silent, "silent", false, "Silent mode - suppress output")
+	c.Flags().BoolVar(&allClusters, "all", false, "Login to every cluster in the namespace given by --namespace.")
+	c.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Login to every cluster in every namespace the user has access to.")
+	c.Flags().StringVarP(&selector, "selector", "l", "", "Only login to clusters matching this label selector, such as env=prod. Implies --all.")
+	c.Flags().BoolVar(&pick, "pick", false, "Choose the clusters to login to from a list of the clusters in --namespace, or in every namespace.")
+	c.Flags().StringVar(&contextName, "context-name", defaultContextName, "Go template naming the contexts of the clusters. It can use {{.Server}}, {{.Host}}, {{.Namespace}}, {{.Cluster}} and {{.User}}.")
+	c.Flags().IntVar(&concurrency, "concurrency", 4, "Number of clusters to login to at the same time.")
+	c.Flags().StringVar(&outputDir, "output-dir", "", "Write each context to a kubeconfig file of its own in this directory instead of to the kubeconfig.")
+	c.Flags().BoolVar(&split, "split", false, "Same as --output-dir ~/.kube/tcli.")
+	c.Flags().BoolVar(&execCredential, "exec-credential", false, "Write exec entries that run \"tcli credential\" instead of storing tokens in the kubeconfig.")
 	return c
 }
+
+// execAuthInfo returns an authinfo which obtains tokens by running
+// "tcli credential", and caches token so that the first kubectl invocation
+// doesn't have to log in again
+func execAuthInfo(server, host, username, namespace, cluster, token string) (*api.AuthInfo, error) {
+	if err := auth.StoreToken(host, username, namespace, cluster, token); err != nil {
+		return nil, err
+	}
+	authInfo := api.NewAuthInfo()
+	authInfo.Exec = auth.ExecConfig(server, username, namespace, cluster)
+	return authInfo, nil
+}
+
+// listClusters returns the clusters in the given namespaces whose labels
+// match selector
+func listClusters(ctx context.Context, c client.Client, namespaces []string, selector string) ([]clusterRef, error) {
+	var refs []clusterRef
+	for _, ns := range namespaces {
+		list, err := c.ClusterList(ctx, ns, selector)
+		if err != nil {
+			return nil, fmt.Errorf("listing clusters in namespace %q: %w", ns, err)
+		}
+		for _, cluster := range list.Items {
+			refs = append(refs, clusterRef{namespace: ns, name: cluster.Name})
+		}
+	}
+	return refs, nil
+}
+
+// loginResult is the outcome of logging in to a cluster
+type loginResult struct {
+	res *client.LoginClusterResponse
+	err error
+}
+
+// loginClusters logs in to the clusters, at most concurrency at a time. The
+// results are returned in the order of refs.
+func loginClusters(ctx context.Context, c client.Client, refs []clusterRef, concurrency int) []loginResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]loginResult, len(refs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		go func(i int, ref clusterRef) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res, err := c.LoginCluster(ctx, ref.name, ref.namespace)
+			if errors.Is(err, client.ErrClusterNotFound) {
+				err = fmt.Errorf("cluster %q not found", ref.name)
+			}
+			results[i] = loginResult{res: res, err: err}
+		}(i, ref)
+	}
+	wg.Wait()
+	return results
+}
+
+// parseContextName parses a --context-name template, and executes it once
+// so that references to unknown fields are reported before logging in
+func parseContextName(text string) (*template.Template, error) {
+	tmpl, err := template.New("context-name").Option("missingkey=error").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, contextNameData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid --context-name: %w", err)
+	}
+	return tmpl, nil
+}
+
+// nameContexts sets the context names of refs from the --context-name
+// template, and makes sure that no two clusters get the same name
+func nameContexts(refs []clusterRef, text, tanzuServer, host, tanzuUsername string) error {
+	tmpl, err := parseContextName(text)
+	if err != nil {
+		return err
+	}
+	named := map[string]clusterRef{}
+	for i, ref := range refs {
+		var b strings.Builder
+		data := contextNameData{Server: tanzuServer, Host: host, Namespace: ref.namespace, Cluster: ref.name, User: tanzuUsername}
+		if err := tmpl.Execute(&b, data); err != nil {
+			return fmt.Errorf("invalid --context-name: %w", err)
+		}
+		name := strings.TrimSpace(b.String())
+		if len(name) == 0 {
+			return fmt.Errorf("--context-name gives cluster %s/%s an empty context name", ref.namespace, ref.name)
+		}
+		if other, ok := named[name]; ok && (other.namespace != ref.namespace || other.name != ref.name) {
+			return fmt.Errorf("clusters %s/%s and %s/%s would both get context name %q, use --context-name to give them unique names", other.namespace, other.name, ref.namespace, ref.name, name)
+		}
+		refs[i].context = name
+		named[name] = refs[i]
+	}
+	return nil
+}
+
+// checkContextOwner returns an error if conf already has a context called
+// name that doesn't belong to the cluster described by info, so that
+// contexts created by hand or for other clusters aren't overwritten. The
+// error ends with hint, which tells how to avoid the conflict.
+func checkContextOwner(conf *api.Config, name string, info auth.ContextInfo, hint string) error {
+	existing, ok := conf.Contexts[name]
+	if !ok {
+		return nil
+	}
+	if _, _, ok := auth.ParseAuthInfoName(existing.AuthInfo); !ok {
+		return fmt.Errorf("context %q already exists and wasn't created by tcli, %s", name, hint)
+	}
+	owner, ok := auth.GetContextInfo(existing, conf.AuthInfos[existing.AuthInfo])
+	if !ok {
+		// Written by an older version of tcli, which only named
+		// contexts after the cluster
+		return nil
+	}
+	if sameHost(owner.Server, info.Server) && owner.Namespace == info.Namespace && owner.Cluster == info.Cluster {
+		return nil
+	}
+	if len(owner.Cluster) == 0 {
+		return fmt.Errorf("context %q already belongs to supervisor %s, %s", name, owner.Server, hint)
+	}
+	return fmt.Errorf("context %q already belongs to cluster %s/%s of %s, %s", name, owner.Namespace, owner.Cluster, owner.Server, hint)
+}
+
+// sameHost reports whether the server URLs a and b have the same host
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return ua.Host == ub.Host
+}
+
+// addCluster adds the cluster, authinfo and context of a guest cluster login
+// to conf and makes it the current context
+func addCluster(conf *api.Config, tanzuServer, host, tanzuUsername string, ref clusterRef, res *client.LoginClusterResponse) error {
+	tanzuCluster, tanzuNamespace := ref.name, ref.namespace
+	info := auth.ContextInfo{Server: tanzuServer, Namespace: tanzuNamespace, Cluster: tanzuCluster}
+	if err := checkContextOwner(conf, ref.context, info, "use --context-name to choose another name"); err != nil {
+		return err
+	}
+
+	caCertData, err := base64.StdEncoding.DecodeString(res.GuestClusterCa)
+	if err != nil {
+		return fmt.Errorf("decoding CA cert for cluster %q: %w", tanzuCluster, err)
+	}
+
+	wlCluster := api.NewCluster()
+	wlCluster.CertificateAuthorityData = caCertData
+	wlCluster.Server = fmt.Sprintf("https://%s:6443", res.GuestClusterServer)
+	wlCluster.ProxyURL = viper.GetString("proxy")
+
+	wlAuthName := fmt.Sprintf("wcp:%s:%s", res.GuestClusterServer, tanzuUsername)
+	wlAuth := api.NewAuthInfo()
+	wlAuth.Token = res.SessionID
+	if execCredential {
+		wlAuth, err = execAuthInfo(tanzuServer, host, tanzuUsername, tanzuNamespace, tanzuCluster, res.SessionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	wlCtx := api.NewContext()
+	wlCtx.Cluster = res.GuestClusterServer
+	wlCtx.AuthInfo = wlAuthName
+	if err := auth.SetContextInfo(wlCtx, info); err != nil {
+		return err
+	}
+
+	// Propagate the namespace into the supervisor context so that
+	// subsequent commands that read --namespace from kubeconfig work
+	// without requiring the flag explicitly.
+	if _, ok := conf.Contexts[host]; ok {
+		conf.Contexts[host].Namespace = tanzuNamespace
+	}
+
+	conf.Clusters[res.GuestClusterServer] = wlCluster
+	conf.AuthInfos[wlAuthName] = wlAuth
+	conf.Contexts[ref.context] = wlCtx
+	conf.CurrentContext = ref.context
+	return nil
+}
+
+// printSummary prints the result of logging in to each cluster
+func printSummary(refs []clusterRef, results []loginResult) error {
+	table := &v1.Table{
+		ColumnDefinitions: []v1.TableColumnDefinition{
+			{Name: "CLUSTER", Type: "string"},
+			{Name: "NAMESPACE", Type: "string"},
+			{Name: "RESULT", Type: "string"},
+			{Name: "DETAILS", Type: "string"},
+		},
+	}
+	for i, ref := range refs {
+		result, details := "Success", ""
+		if results[i].err != nil {
+			result, details = "Failed", results[i].err.Error()
+		}
+		table.Rows = append(table.Rows, v1.TableRow{
+			Cells: []interface{}{ref.name, ref.namespace, result, details},
+		})
+	}
+	printer := printers.NewTablePrinter(printers.PrintOptions{})
+	return printer.PrintObj(table, os.Stdout)
+}
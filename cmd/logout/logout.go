@@ -1,12 +1,19 @@
 package logout
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"net/url"
 
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	tanzuCluster string
+	allUsers     bool
+	dryRun       bool
 )
 
 func NewCmdLogout() *cobra.Command {
@@ -16,48 +23,116 @@ func NewCmdLogout() *cobra.Command {
 		Long: `Logout user and remove all WCP credentials from the kubeconfig.
 
 All contexts, clusters, and authinfos that were written by "tcli login" for
-the current user are removed from the kubeconfig file.
+the current user are removed from the kubeconfig file. The supervisor has no
+API for ending sessions, so the session tokens stay valid until they expire.
+
+The contexts to log out of can be narrowed down to a single supervisor with
+--server, or to a single guest cluster with --cluster.
 
 Examples:
 	# Logout the current user
 	tcli -s SERVER -u USER logout
 
+	# Logout of a single guest cluster
+	tcli -u USER logout --cluster CLUSTER
+
+	# Logout every user of a supervisor
+	tcli -s SERVER logout --all-users
+
+	# Show what would be removed without changing anything
+	tcli -u USER logout --dry-run
+
 	Use "tcli --help" for a list of global command-line options (applies to all commands).
 	`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+			if !allUsers && len(viper.GetString("username")) == 0 {
+				return errors.New("--username is required, use --all-users to logout every user")
+			}
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			tanzuServer := viper.GetString("server")
 			tanzuUsername := viper.GetString("username")
-			kubeconfig := viper.GetString("kubeconfig")
 
-			// Read kubeconfig from file
-			conf, err := clientcmd.LoadFromFile(kubeconfig)
+			var host string
+			if len(tanzuServer) > 0 {
+				u, err := url.Parse(tanzuServer)
+				if err != nil {
+					return fmt.Errorf("parsing server URL: %w", err)
+				}
+				host = u.Host
+			}
+
+			conf, err := auth.LoadKubeconfig()
 			if err != nil {
-				return fmt.Errorf("loading kubeconfig: %w", err)
+				return err
 			}
 
-			removed := 0
-			for k, v := range conf.Contexts {
-				userSplit := strings.Split(v.AuthInfo, ":")
-				if len(userSplit) == 3 && userSplit[0] == "wcp" && userSplit[2] == tanzuUsername {
-					delete(conf.Clusters, v.Cluster)
-					delete(conf.AuthInfos, v.AuthInfo)
-					delete(conf.Contexts, k)
-					removed++
+			var selected []auth.ManagedContext
+			for _, mc := range auth.ManagedContexts(conf) {
+				if !allUsers && mc.Username != tanzuUsername {
+					continue
 				}
+				info, _ := mc.Info()
+				if len(host) > 0 && supervisorHost(info) != host {
+					continue
+				}
+				if len(tanzuCluster) > 0 && (mc.Supervisor || (info.Cluster != tanzuCluster && mc.Name != tanzuCluster)) {
+					continue
+				}
+				selected = append(selected, mc)
 			}
 
-			if removed == 0 {
-				fmt.Printf("No credentials found for user %q — nothing to remove.\n", tanzuUsername)
+			if len(selected) == 0 {
+				if allUsers {
+					fmt.Println("No credentials found — nothing to remove.")
+				} else {
+					fmt.Printf("No credentials found for user %q — nothing to remove.\n", tanzuUsername)
+				}
 				return nil
 			}
 
-			// Write back to kubeconfig
-			if err := clientcmd.WriteToFile(*conf, kubeconfig); err != nil {
-				return fmt.Errorf("writing kubeconfig: %w", err)
+			for _, mc := range selected {
+				if dryRun {
+					fmt.Printf("Would remove context %q\n", mc.Name)
+					continue
+				}
+				auth.RemoveContext(conf, mc)
+				auth.DeleteContextToken(mc)
+			}
+
+			if dryRun {
+				return nil
 			}
 
-			fmt.Printf("Removed %d context(s) for user %q.\n", removed, tanzuUsername)
+			// Write back to the kubeconfig files holding the contexts
+			if err := auth.SaveKubeconfig(conf); err != nil {
+				return err
+			}
+
+			if allUsers {
+				fmt.Printf("Removed %d context(s).\n", len(selected))
+			} else {
+				fmt.Printf("Removed %d context(s) for user %q.\n", len(selected), tanzuUsername)
+			}
 			return nil
 		},
 	}
+	c.Flags().StringVar(&tanzuCluster, "cluster", "", "Only logout of the guest cluster with this name.")
+	c.Flags().BoolVar(&allUsers, "all-users", false, "Logout every user instead of only the one given by --username.")
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "Only print what would be removed.")
 	return c
 }
+
+// supervisorHost returns the host of the supervisor the context was logged
+// in to, or the empty string if it isn't known
+func supervisorHost(info auth.ContextInfo) string {
+	u, err := url.Parse(info.Server)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
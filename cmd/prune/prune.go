@@ -0,0 +1,338 @@
+package prune
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+var (
+	dryRun      bool
+	gracePeriod time.Duration
+	offline     bool
+)
+
+// stale is a kubeconfig entry to remove
+type stale struct {
+	kind   string
+	name   string
+	reason string
+}
+
+func NewCmdPrune() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "prune",
+		Args:  cobra.NoArgs,
+		Short: "Remove stale contexts written by tcli from the kubeconfig",
+		Long: `Remove stale contexts written by tcli from the kubeconfig
+
+Every context written by "tcli login" is examined, and removed when
+	- its session token expired longer ago than --grace-period
+	- its guest cluster, or the namespace of it, no longer exists on the supervisor
+	- the cluster or user entry it refers to is missing from the kubeconfig
+
+Users and clusters written by tcli that no context refers to anymore are
+removed as well. Contexts created by other tools are never touched.
+
+Guest clusters are looked up using the supervisor contexts in the kubeconfig,
+so log in to the supervisors first, or use --offline to skip the lookup.
+
+Examples:
+	# Show what would be removed without changing anything
+	tcli prune --dry-run
+
+	# Remove contexts whose tokens expired more than a day ago, or whose
+	# clusters have been deleted
+	tcli prune --grace-period 24h
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := auth.LoadKubeconfig()
+			if err != nil {
+				return err
+			}
+
+			// A dry run removes the entries from a copy of the kubeconfig,
+			// so that the same entries are listed as in a real run.
+			// Orphans are recognized by the kubeconfig before pruning.
+			original := conf.DeepCopy()
+			work := conf
+			if dryRun {
+				work = conf.DeepCopy()
+			}
+
+			contexts := auth.ManagedContexts(work)
+			var found []stale
+			for _, mc := range contexts {
+				if reason, ok := staleReason(work, mc, time.Now()); ok {
+					found = append(found, stale{"context", mc.Name, reason})
+				}
+			}
+			if !offline {
+				found = append(found, deletedClusters(contexts, found)...)
+			}
+
+			var entries []stale
+			for _, s := range found {
+				for _, mc := range contexts {
+					if mc.Name != s.name {
+						continue
+					}
+					authInfo, cluster := auth.RemoveContext(work, mc)
+					if len(authInfo) > 0 {
+						entries = append(entries, stale{"user", authInfo, fmt.Sprintf("only used by context %q", mc.Name)})
+					}
+					if len(cluster) > 0 {
+						entries = append(entries, stale{"cluster", cluster, fmt.Sprintf("only used by context %q", mc.Name)})
+					}
+					if !dryRun {
+						auth.DeleteContextToken(mc)
+					}
+				}
+			}
+			found = append(found, entries...)
+			found = append(found, orphans(work, original)...)
+
+			if len(found) == 0 {
+				fmt.Println("Nothing to prune")
+				return nil
+			}
+			if err := printStale(found); err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Printf("Would remove %d entries\n", len(found))
+				return nil
+			}
+			if err := auth.SaveKubeconfig(conf); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %d entries\n", len(found))
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "Only print what would be removed.")
+	c.Flags().DurationVar(&gracePeriod, "grace-period", 7*24*time.Hour, "How long after its token has expired a context is kept, so that it can still be renewed with \"tcli refresh\".")
+	c.Flags().BoolVar(&offline, "offline", false, "Don't ask the supervisors whether guest clusters still exist.")
+	return c
+}
+
+// staleReason reports whether the context can be removed without asking the
+// supervisor, and why
+func staleReason(conf *api.Config, mc auth.ManagedContext, now time.Time) (string, bool) {
+	if _, ok := conf.Clusters[mc.Context.Cluster]; !ok {
+		return fmt.Sprintf("cluster entry %q is missing", mc.Context.Cluster), true
+	}
+	if mc.AuthInfo == nil {
+		return fmt.Sprintf("user entry %q is missing", mc.Context.AuthInfo), true
+	}
+	// Exec credential entries renew their tokens themselves
+	if mc.AuthInfo.Exec != nil {
+		return "", false
+	}
+	t, err := auth.ParseToken(auth.StoredToken(mc.AuthInfo))
+	if err != nil || t.ExpiresAt.IsZero() {
+		return "", false
+	}
+	if expired := -t.Remaining(now); expired > gracePeriod {
+		return fmt.Sprintf("token expired %s ago", duration.HumanDuration(expired)), true
+	}
+	return "", false
+}
+
+// deletedClusters returns the guest cluster contexts whose cluster no longer
+// exists on the supervisor. Contexts in removed are skipped. The supervisor
+// is asked using its context in the kubeconfig, and contexts that can't be
+// checked are kept.
+func deletedClusters(contexts []auth.ManagedContext, removed []stale) []stale {
+	skip := map[string]bool{}
+	for _, s := range removed {
+		skip[s.name] = true
+	}
+
+	// Group the guest contexts by supervisor and user, so that each
+	// supervisor is only asked once per namespace
+	type groupKey struct{ server, username string }
+	type guest struct {
+		name string
+		info auth.ContextInfo
+	}
+	groups := map[groupKey][]guest{}
+	for _, mc := range contexts {
+		if mc.Supervisor || skip[mc.Name] {
+			continue
+		}
+		info, ok := mc.Info()
+		if !ok || len(info.Cluster) == 0 {
+			continue
+		}
+		key := groupKey{info.Server, mc.Username}
+		groups[key] = append(groups[key], guest{mc.Name, info})
+	}
+
+	var res []stale
+	for key, guests := range groups {
+		gone, err := clusterLookup(key.server, key.username)
+		if err != nil {
+			slog.Warn("could not check whether clusters still exist", "server", key.server, "username", key.username, "error", err)
+			continue
+		}
+		for _, g := range guests {
+			if reason, ok := gone(g.info.Namespace, g.info.Cluster); ok {
+				res = append(res, stale{"context", g.name, reason})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].name < res[j].name
+	})
+	return res
+}
+
+// clusterLookup returns a function reporting whether a guest cluster of the
+// supervisor at server is gone, and why. Clusters are listed once per
+// namespace.
+func clusterLookup(server, username string) (func(namespace, cluster string) (string, bool), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+	defer cancel()
+
+	opts, err := auth.ClientOptions(server)
+	if err != nil {
+		return nil, err
+	}
+	// A dry run changes nothing, so expired tokens aren't renewed
+	var c client.Client
+	if dryRun {
+		c, err = auth.TokenClient(server, username, opts...)
+	} else {
+		c, _, err = auth.ClientFromKubeconfig(server, username, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Listing the namespaces takes the password. Without one, deleted
+	// namespaces are only noticed when listing their clusters fails.
+	var namespaces map[string]bool
+	nc, err := auth.NamespacesClient(server, username, auth.Interactive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := nc.Namespaces(ctx)
+	switch {
+	case errors.Is(err, auth.ErrNoPassword):
+		slog.Debug("not checking whether namespaces still exist", "server", server, "username", username, "error", err)
+	case err != nil:
+		return nil, err
+	default:
+		namespaces = map[string]bool{}
+		for _, n := range ns {
+			namespaces[n.Namespace] = true
+		}
+	}
+
+	clusters := map[string]map[string]bool{}
+	return func(namespace, cluster string) (string, bool) {
+		if namespaces != nil && !namespaces[namespace] {
+			return fmt.Sprintf("namespace %q no longer exists", namespace), true
+		}
+		names, ok := clusters[namespace]
+		if !ok {
+			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+			defer cancel()
+			list, err := c.ClusterList(ctx, namespace, "")
+			if err != nil {
+				slog.Warn("could not list clusters", "server", server, "namespace", namespace, "error", err)
+				return "", false
+			}
+			names = map[string]bool{}
+			for _, tkc := range list.Items {
+				names[tkc.Name] = true
+			}
+			clusters[namespace] = names
+		}
+		if !names[cluster] {
+			return fmt.Sprintf("cluster %s/%s no longer exists", namespace, cluster), true
+		}
+		return "", false
+	}, nil
+}
+
+// orphans removes the users and clusters written by tcli that no context
+// refers to from conf, and returns them. Clusters are recognized as written
+// by tcli by the users in original, the kubeconfig before pruning.
+func orphans(conf, original *api.Config) []stale {
+	usedAuth, usedCluster := map[string]bool{}, map[string]bool{}
+	for _, ctx := range conf.Contexts {
+		usedAuth[ctx.AuthInfo] = true
+		usedCluster[ctx.Cluster] = true
+	}
+
+	// tcli names clusters after the host its users are issued for
+	hosts := map[string]bool{}
+	for name := range original.AuthInfos {
+		if host, _, ok := auth.ParseAuthInfoName(name); ok {
+			hosts[host] = true
+		}
+	}
+	var res []stale
+	for name := range conf.AuthInfos {
+		if _, _, ok := auth.ParseAuthInfoName(name); ok && !usedAuth[name] {
+			res = append(res, stale{"user", name, "not used by any context"})
+		}
+	}
+	for name := range conf.Clusters {
+		if hosts[name] && !usedCluster[name] {
+			res = append(res, stale{"cluster", name, "not used by any context"})
+		}
+	}
+
+	for _, s := range res {
+		if s.kind == "user" {
+			delete(conf.AuthInfos, s.name)
+		} else {
+			delete(conf.Clusters, s.name)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].kind != res[j].kind {
+			return res[i].kind > res[j].kind
+		}
+		return res[i].name < res[j].name
+	})
+	return res
+}
+
+func printStale(found []stale) error {
+	table := &v1.Table{
+		ColumnDefinitions: []v1.TableColumnDefinition{
+			{Name: "KIND", Type: "string"},
+			{Name: "NAME", Type: "string"},
+			{Name: "REASON", Type: "string"},
+		},
+	}
+	for _, s := range found {
+		table.Rows = append(table.Rows, v1.TableRow{
+			Cells: []interface{}{s.kind, s.name, s.reason},
+		})
+	}
+	printer := printers.NewTablePrinter(printers.PrintOptions{})
+	return printer.PrintObj(table, os.Stdout)
+}
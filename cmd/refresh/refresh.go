@@ -0,0 +1,264 @@
+package refresh
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+var onlyExpired bool
+
+// Results of refreshing a context
+const (
+	resultRefreshed = "Refreshed"
+	resultSkipped   = "Skipped"
+	resultFailed    = "Failed"
+)
+
+// target is a context to refresh
+type target struct {
+	mc   auth.ManagedContext
+	info auth.ContextInfo
+}
+
+// result is the outcome of refreshing a context
+type result struct {
+	context  string
+	server   string
+	username string
+	result   string
+	details  string
+}
+
+func NewCmdRefresh() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "refresh",
+		Args:  cobra.NoArgs,
+		Short: "Renew the session tokens of every context written by tcli",
+		Long: `Renew the session tokens of every context written by tcli
+
+All contexts previously written by "tcli login" are grouped by supervisor and
+user. tcli logs in once to each supervisor, using the password from the
+credential sources or prompting for it, and then logs in to every guest
+cluster again. The result of each context is shown in a table.
+
+Examples:
+	# Renew every session
+	tcli refresh
+
+	# Only renew sessions that have expired
+	tcli refresh --only-expired
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return viper.BindPFlags(cmd.Flags())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := auth.LoadKubeconfig()
+			if err != nil {
+				return err
+			}
+
+			contexts := auth.ManagedContexts(conf)
+			if len(contexts) == 0 {
+				fmt.Println("Not logged in. Please run 'tcli login' to authenticate")
+				return nil
+			}
+
+			// Group the contexts by supervisor and user so that each
+			// supervisor is only logged in to once
+			type groupKey struct{ server, username string }
+			groups := map[groupKey][]target{}
+			var results []result
+			now := time.Now()
+			for _, mc := range contexts {
+				info, ok := mc.Info()
+				if !ok {
+					results = append(results, result{
+						context:  mc.Name,
+						username: mc.Username,
+						result:   resultSkipped,
+						details:  "unknown supervisor, run 'tcli login' for this cluster once",
+					})
+					continue
+				}
+				if mc.AuthInfo == nil {
+					results = append(results, result{
+						context:  mc.Name,
+						server:   info.Server,
+						username: mc.Username,
+						result:   resultSkipped,
+						details:  "user entry missing, run 'tcli prune'",
+					})
+					continue
+				}
+				if onlyExpired {
+					if t, err := auth.ParseToken(auth.StoredToken(mc.AuthInfo)); err == nil && !t.Expired(now) {
+						results = append(results, result{
+							context:  mc.Name,
+							server:   info.Server,
+							username: mc.Username,
+							result:   resultSkipped,
+							details:  "token still valid",
+						})
+						continue
+					}
+				}
+				key := groupKey{info.Server, mc.Username}
+				groups[key] = append(groups[key], target{mc: mc, info: info})
+			}
+
+			keys := make([]groupKey, 0, len(groups))
+			for k := range groups {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				if keys[i].server != keys[j].server {
+					return keys[i].server < keys[j].server
+				}
+				return keys[i].username < keys[j].username
+			})
+			for _, k := range keys {
+				results = append(results, refreshGroup(conf, k.server, k.username, groups[k])...)
+			}
+
+			if err := auth.SaveKubeconfig(conf); err != nil {
+				return err
+			}
+
+			sort.SliceStable(results, func(i, j int) bool {
+				return results[i].context < results[j].context
+			})
+			if err := printResults(results); err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, r := range results {
+				if r.result == resultFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to refresh %d of %d contexts", failed, len(results))
+			}
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&onlyExpired, "only-expired", false, "Only renew tokens that have expired, skipping those that are still valid.")
+	return c
+}
+
+// refreshGroup logs in to server as username and renews the tokens of the
+// targets, which all belong to that supervisor and user. conf is updated in
+// memory.
+func refreshGroup(conf *api.Config, server, username string, targets []target) []result {
+	results := make([]result, 0, len(targets))
+	fail := func(err error) []result {
+		for _, t := range targets {
+			results = append(results, result{t.mc.Name, server, username, resultFailed, err.Error()})
+		}
+		return results
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+	defer cancel()
+
+	password, err := auth.ResolvePassword(server, username, auth.Interactive)
+	if err != nil {
+		return fail(err)
+	}
+	opts, err := auth.ClientOptions(server)
+	if err != nil {
+		return fail(err)
+	}
+	c, err := client.New(server, append(opts, client.WithCredentials(client.BasicCredentials(username, password)))...)
+	if err != nil {
+		return fail(err)
+	}
+	sess, err := c.Login(ctx, username, password)
+	if err != nil {
+		return fail(err)
+	}
+
+	for _, t := range targets {
+		r := result{context: t.mc.Name, server: server, username: username}
+		token := sess.SessionID
+		var err error
+		if len(t.info.Cluster) > 0 {
+			token, err = loginCluster(ctx, c, conf, t)
+		}
+		if err == nil {
+			err = auth.SetToken(t.mc.AuthInfo, server, username, t.info.Namespace, t.info.Cluster, token)
+		}
+		if err != nil {
+			r.result, r.details = resultFailed, err.Error()
+		} else {
+			r.result, r.details = resultRefreshed, expiry(token)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// loginCluster logs in to the guest cluster of t and updates its cluster
+// entry in conf, in case the server address or CA has changed
+func loginCluster(ctx context.Context, c client.Client, conf *api.Config, t target) (string, error) {
+	res, err := c.LoginCluster(ctx, t.info.Cluster, t.info.Namespace)
+	if err != nil {
+		if errors.Is(err, client.ErrClusterNotFound) {
+			return "", fmt.Errorf("cluster %q not found", t.info.Cluster)
+		}
+		return "", err
+	}
+	caCertData, err := base64.StdEncoding.DecodeString(res.GuestClusterCa)
+	if err != nil {
+		return "", fmt.Errorf("decoding CA cert for cluster %q: %w", t.info.Cluster, err)
+	}
+	if cluster, ok := conf.Clusters[t.mc.Context.Cluster]; ok {
+		cluster.Server = fmt.Sprintf("https://%s:6443", res.GuestClusterServer)
+		cluster.CertificateAuthorityData = caCertData
+	}
+	return res.SessionID, nil
+}
+
+// expiry describes when token expires
+func expiry(token string) string {
+	info, err := auth.ParseToken(token)
+	if err != nil || info.ExpiresAt.IsZero() {
+		return ""
+	}
+	return "expires " + info.ExpiresAt.Local().Format("2006-01-02 15:04")
+}
+
+func printResults(results []result) error {
+	table := &v1.Table{
+		ColumnDefinitions: []v1.TableColumnDefinition{
+			{Name: "CONTEXT", Type: "string"},
+			{Name: "SUPERVISOR", Type: "string"},
+			{Name: "USER", Type: "string"},
+			{Name: "RESULT", Type: "string"},
+			{Name: "DETAILS", Type: "string"},
+		},
+	}
+	for _, r := range results {
+		table.Rows = append(table.Rows, v1.TableRow{
+			Cells: []interface{}{r.context, r.server, r.username, r.result, r.details},
+		})
+	}
+	printer := printers.NewTablePrinter(printers.PrintOptions{})
+	return printer.PrintObj(table, os.Stdout)
+}
@@ -1,46 +1,73 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/middlewaregruppen/tcli/cmd/completion"
+	"github.com/middlewaregruppen/tcli/cmd/config"
+	"github.com/middlewaregruppen/tcli/cmd/contexts"
+	"github.com/middlewaregruppen/tcli/cmd/credential"
+	"github.com/middlewaregruppen/tcli/cmd/credentials"
+	"github.com/middlewaregruppen/tcli/cmd/devserver"
 	"github.com/middlewaregruppen/tcli/cmd/inspect"
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/cmd/kubeconfig"
 	"github.com/middlewaregruppen/tcli/cmd/list"
 	"github.com/middlewaregruppen/tcli/cmd/login"
 	"github.com/middlewaregruppen/tcli/cmd/logout"
+	"github.com/middlewaregruppen/tcli/cmd/prune"
+	"github.com/middlewaregruppen/tcli/cmd/refresh"
+	"github.com/middlewaregruppen/tcli/cmd/status"
 	"github.com/middlewaregruppen/tcli/cmd/use"
 	"github.com/middlewaregruppen/tcli/cmd/version"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/clientcmd/api"
+	"github.com/middlewaregruppen/tcli/pkg/credstore"
+	tclikubeconfig "github.com/middlewaregruppen/tcli/pkg/kubeconfig"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	tanzuServer        string
-	tanzuUsername      string
-	tanzuPassword      string
-	insecureSkipVerify bool
-	debug              bool
-	kubeconfig         string
-	timeout            time.Duration
+	tanzuServer          string
+	tanzuUsername        string
+	tanzuPassword        string
+	insecureSkipVerify   bool
+	debug                bool
+	kubeconfigPath       string
+	timeout              time.Duration
+	recordFile           string
+	replayFile           string
+	autoLogin            bool
+	credentialStore      string
+	passwordStdin        bool
+	passwordFile         string
+	passwordCommand      string
+	certificateAuthority string
+	tlsServerName        string
+	profile              string
+	proxy                string
+	kubeconfigBackups    int
 )
 
 func init() {
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("TCLI")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 }
 
 func NewDefaultCommand() *cobra.Command {
 	c := &cobra.Command{
 		SilenceUsage:  true,
 		SilenceErrors: true,
-		Use:           "tcli",
-		Short:         "A command line tool that simplifies authentication to Tanzu namespaces and clusters",
+		// Replaced by "tcli completion", which documents how to install
+		// the completions
+		CompletionOptions: cobra.CompletionOptions{DisableDefaultCmd: true},
+		Use:               "tcli",
+		Short:             "A command line tool that simplifies authentication to Tanzu namespaces and clusters",
 		Long: `A command line tool that simplifies authentication to Tanzu namespaces and clusters.
 	tcli is a simple CLI tool to:
 	- Simplify login process over the default vpshere plugin
@@ -50,7 +77,14 @@ func NewDefaultCommand() *cobra.Command {
 	export TCLI_SERVER=https://supervisor.local
 	export TCLI_USERNAME=bob
 	export TCLI_PASSWORD=mypassword
-	export TCLI_INSECURE=true
+	export TCLI_CERTIFICATE_AUTHORITY=/etc/ssl/supervisor-ca.pem
+	export TCLI_AUTO_LOGIN=true
+
+	Flag values can also be kept in named profiles in ~/.config/tcli/config.yaml,
+	see "tcli config --help"
+
+	tcli config set server https://supervisor.local --profile lab
+	tcli config use-profile lab
 
 	Use "tcli --help" for a list of global command-line options (applies to all commands).
 	`,
@@ -64,20 +98,13 @@ func NewDefaultCommand() *cobra.Command {
 			if err := viper.BindPFlags(cmd.Flags()); err != nil {
 				return err
 			}
-
-			// Check if kubeconfig exists, create if it doesn't
-			if _, err := os.Stat(kubeconfig); errors.Is(err, os.ErrNotExist) {
-				_, err = os.OpenFile(kubeconfig, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
-				if err != nil {
-					return err
-				}
-				conf := api.NewConfig()
-				err = clientcmd.WriteToFile(*conf, kubeconfig)
-				if err != nil {
-					return err
-				}
+			if err := auth.ApplyProfile(); err != nil {
+				return err
 			}
-			return nil
+
+			// Create the kubeconfig that new entries are written to if it
+			// doesn't exist, readable by the user only
+			return auth.KubeconfigStore().Create()
 		},
 	}
 
@@ -92,8 +119,20 @@ func NewDefaultCommand() *cobra.Command {
 	c.PersistentFlags().StringVarP(&tanzuServer, "server", "s", "", "Address of the server to authenticate against.")
 	c.PersistentFlags().StringVarP(&tanzuUsername, "username", "u", "", "Username to authenticate.")
 	c.PersistentFlags().StringVarP(&tanzuPassword, "password", "p", "", "Password to use for authentication.")
+	c.PersistentFlags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password from stdin.")
+	c.PersistentFlags().StringVar(&passwordFile, "password-file", "", "Read the password from the first line of a file.")
+	c.PersistentFlags().StringVar(&passwordCommand, "password-command", "", "Read the password from the output of a command, which is run without a shell.")
 	c.PersistentFlags().BoolVarP(&insecureSkipVerify, "insecure", "i", false, "Skip certificate verification (this is insecure).")
-	c.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", fmt.Sprintf("%s/.kube/config", homedir), "Path to kubeconfig file.")
+	c.PersistentFlags().StringVar(&certificateAuthority, "certificate-authority", "", "Path to a PEM encoded CA bundle used to verify the supervisor certificate.")
+	c.PersistentFlags().StringVar(&tlsServerName, "tls-server-name", "", "Server name used to verify the supervisor certificate, if it differs from the server host name.")
+	c.PersistentFlags().StringVar(&profile, "profile", "", "Name of the profile in the tcli configuration file to take flag values from.")
+	c.PersistentFlags().StringVar(&proxy, "proxy", "", "URL of an http, https or socks5 proxy to connect to the supervisor through. Also written to the kubeconfig for kubectl.")
+	c.PersistentFlags().StringVar(&kubeconfigPath, "kubeconfig", fmt.Sprintf("%s/.kube/config", homedir), "Path to kubeconfig file. Without it, the files listed in KUBECONFIG are used like kubectl does.")
+	c.PersistentFlags().IntVar(&kubeconfigBackups, "kubeconfig-backups", tclikubeconfig.DefaultBackups, "Number of kubeconfig backups to keep, see \"tcli kubeconfig --help\". 0 disables backups.")
+	c.PersistentFlags().BoolVar(&autoLogin, "auto-login", false, "Log in again automatically when the session has expired, using a password available without prompting: --password, --password-stdin, --password-file, --password-command, the credential store or ~/.netrc.")
+	c.PersistentFlags().StringVar(&credentialStore, "credential-store", credstore.FileBackendName, fmt.Sprintf("Credential store used to look up passwords. One of %v.", credstore.Backends()))
+	c.PersistentFlags().StringVar(&recordFile, "record", "", "Record HTTP traffic to this file as JSON lines, with credentials redacted.")
+	c.PersistentFlags().StringVar(&replayFile, "replay", "", "Serve HTTP responses from a file written by --record instead of the network. Tokens in recordings are redacted, so the kubeconfig is only written if --kubeconfig is given.")
 
 	// Setup sub-commands
 	c.AddCommand(version.NewCmdVersion())
@@ -102,6 +141,16 @@ func NewDefaultCommand() *cobra.Command {
 	c.AddCommand(inspect.NewCmdInspect())
 	c.AddCommand(list.NewCmdList())
 	c.AddCommand(use.NewCmdUse())
+	c.AddCommand(status.NewCmdStatus())
+	c.AddCommand(contexts.NewCmdContexts())
+	c.AddCommand(refresh.NewCmdRefresh())
+	c.AddCommand(prune.NewCmdPrune())
+	c.AddCommand(credential.NewCmdCredential())
+	c.AddCommand(credentials.NewCmdCredentials())
+	c.AddCommand(config.NewCmdConfig())
+	c.AddCommand(kubeconfig.NewCmdKubeconfig())
+	c.AddCommand(completion.NewCmdCompletion())
+	c.AddCommand(devserver.NewCmdDevServer())
 
 	return c
 }
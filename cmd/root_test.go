@@ -0,0 +1,515 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd"
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/pkg/supervisortest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	testUser     = "bob"
+	testPassword = "secret"
+)
+
+// testHome is the home directory of tcli in the tests. tcli keeps its
+// kubeconfig store and trust store for the whole process, so every test shares
+// the directory and starts from an empty kubeconfig.
+var testHome string
+
+func TestMain(m *testing.M) {
+	var err error
+	testHome, err = os.MkdirTemp("", "tcli-test-")
+	if err != nil {
+		panic(err)
+	}
+	// KUBECONFIG is set because the default kubeconfig of client-go is
+	// taken from the home directory before the tests start
+	for key, value := range map[string]string{
+		"HOME":            testHome,
+		"XDG_CONFIG_HOME": filepath.Join(testHome, ".config"),
+		"XDG_CACHE_HOME":  filepath.Join(testHome, ".cache"),
+		"KUBECONFIG":      filepath.Join(testHome, ".kube", "config"),
+	} {
+		os.Setenv(key, value)
+	}
+	code := m.Run()
+	os.RemoveAll(testHome)
+	os.Exit(code)
+}
+
+// testEnv is a supervisor simulator for tcli to log in to
+type testEnv struct {
+	t   *testing.T
+	srv *supervisortest.Server
+	ca  string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	srv := supervisortest.NewServer(
+		supervisortest.WithUser(testUser, testPassword),
+		supervisortest.WithCluster(supervisortest.Cluster{Namespace: "team-a", Name: "web", Labels: map[string]string{"env": "prod"}}),
+		supervisortest.WithCluster(supervisortest.Cluster{Namespace: "team-a", Name: "db"}),
+		supervisortest.WithCluster(supervisortest.Cluster{Namespace: "team-b", Name: "api", Labels: map[string]string{"env": "prod"}}),
+		supervisortest.WithCluster(supervisortest.Cluster{Namespace: "team-b", Name: "test"}),
+	)
+	t.Cleanup(srv.Close)
+
+	if err := os.Remove(os.Getenv("KUBECONFIG")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, srv.CertificatePEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &testEnv{t: t, srv: srv, ca: ca}
+}
+
+// run runs tcli with args against the simulator, and returns what it wrote
+// to stdout. The flags for the simulator come first, so that args may
+// override them.
+func (e *testEnv) run(args ...string) (string, error) {
+	e.t.Helper()
+	args = append([]string{
+		"--server", e.srv.URL,
+		"--username", testUser,
+		"--password", testPassword,
+		"--certificate-authority", e.ca,
+	}, args...)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		_, _ = io.Copy(&b, r)
+		out <- b.String()
+	}()
+
+	c := cmd.NewDefaultCommand()
+	c.SetArgs(args)
+	err = c.Execute()
+
+	os.Stdout = stdout
+	w.Close()
+	return <-out, err
+}
+
+// mustRun is like run, but fails the test if tcli fails
+func (e *testEnv) mustRun(args ...string) string {
+	e.t.Helper()
+	out, err := e.run(args...)
+	if err != nil {
+		e.t.Fatalf("tcli %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+func (e *testEnv) kubeconfig() *api.Config {
+	e.t.Helper()
+	conf, err := clientcmd.LoadFromFile(os.Getenv("KUBECONFIG"))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return conf
+}
+
+// contexts returns the sorted names of the contexts in the kubeconfig
+func (e *testEnv) contexts() []string {
+	e.t.Helper()
+	var names []string
+	for name := range e.kubeconfig().Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *testEnv) expectContexts(want ...string) {
+	e.t.Helper()
+	sort.Strings(want)
+	if got := e.contexts(); !reflect.DeepEqual(got, want) {
+		e.t.Errorf("kubeconfig has contexts %v, want %v", got, want)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	e := newTestEnv(t)
+	out := e.mustRun("login", "web", "-n", "team-a")
+	if !strings.Contains(out, "Successfully logged into cluster web") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	e.expectContexts(e.srv.Host(), "web")
+
+	conf := e.kubeconfig()
+	if conf.CurrentContext != "web" {
+		t.Errorf("current context is %q, want web", conf.CurrentContext)
+	}
+	if ns := conf.Contexts[e.srv.Host()].Namespace; ns != "team-a" {
+		t.Errorf("supervisor context namespace is %q, want team-a", ns)
+	}
+	if server := conf.Clusters[conf.Contexts["web"].Cluster].Server; server != "https://web.team-a.tkg.local:6443" {
+		t.Errorf("guest cluster server is %q", server)
+	}
+	if token := conf.AuthInfos[conf.Contexts["web"].AuthInfo].Token; len(token) == 0 {
+		t.Error("guest cluster context has no token")
+	}
+
+	if _, err := e.run("login", "missing", "-n", "team-a"); err == nil {
+		t.Error("login to a missing cluster succeeded")
+	}
+}
+
+func TestLoginAll(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "--all", "-n", "team-b")
+	e.expectContexts(e.srv.Host(), "api", "test")
+
+	e = newTestEnv(t)
+	e.mustRun("login", "--all-namespaces")
+	e.expectContexts(e.srv.Host(), "api", "db", "test", "web")
+}
+
+func TestLoginSelector(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "-A", "-l", "env=prod")
+	e.expectContexts(e.srv.Host(), "api", "web")
+
+	if _, err := e.run("login", "-l", "env=prod"); err == nil {
+		t.Error("--selector without --namespace or --all-namespaces succeeded")
+	}
+}
+
+func TestLoginKeepsForeignContexts(t *testing.T) {
+	for _, name := range []string{"supervisor", "web"} {
+		t.Run(name, func(t *testing.T) {
+			e := newTestEnv(t)
+			if name == "supervisor" {
+				name = e.srv.Host()
+			}
+			conf := api.NewConfig()
+			conf.Clusters["mine"] = &api.Cluster{Server: "https://mine.local"}
+			conf.AuthInfos["me"] = &api.AuthInfo{Token: "hand-written"}
+			conf.Contexts[name] = &api.Context{Cluster: "mine", AuthInfo: "me"}
+			if err := clientcmd.WriteToFile(*conf, os.Getenv("KUBECONFIG")); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := e.run("login", "web", "-n", "team-a")
+			if err == nil || !strings.Contains(err.Error(), "wasn't created by tcli") {
+				t.Errorf("got %v, want an error about the context created by hand", err)
+			}
+			if got := e.kubeconfig().Contexts[name]; got == nil || got.Cluster != "mine" || got.AuthInfo != "me" {
+				t.Errorf("context %q created by hand was overwritten with %v", name, got)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	e := newTestEnv(t)
+	// Logging into a cluster sets the namespace of the supervisor context
+	e.mustRun("login", "web", "-n", "team-a")
+
+	if out := e.mustRun("list", "namespaces"); out != "team-a\nteam-b\n" {
+		t.Errorf("list namespaces printed\n%s", out)
+	}
+
+	// Without --namespace the namespace of the supervisor context is used
+	out := e.mustRun("list", "clusters")
+	for _, want := range []string{"NAME", "web", "db"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("list clusters doesn't show %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "api") {
+		t.Errorf("list clusters shows a cluster of another namespace:\n%s", out)
+	}
+	if out := e.mustRun("list", "clusters", "-n", "team-b"); !strings.Contains(out, "api") {
+		t.Errorf("list clusters -n team-b doesn't show api:\n%s", out)
+	}
+	if out := e.mustRun("list", "releases"); !strings.Contains(out, "v1.23.8---vmware.3-tkg.1") {
+		t.Errorf("list releases doesn't show the release of the clusters:\n%s", out)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "-n", "team-a")
+
+	out := e.mustRun("inspect", "api", "-n", "team-b")
+	for _, want := range []string{"kind: TanzuKubernetesCluster", "name: api", "namespace: team-b"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("inspect doesn't show %q:\n%s", want, out)
+		}
+	}
+	if _, err := e.run("inspect", "missing", "-n", "team-b"); err == nil {
+		t.Error("inspecting a missing cluster succeeded")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "web", "db", "-n", "team-a")
+	before := e.contexts()
+
+	out := e.mustRun("logout", "--dry-run")
+	for _, name := range before {
+		if !strings.Contains(out, "remove context "+`"`+name+`"`) {
+			t.Errorf("logout --dry-run doesn't mention context %q:\n%s", name, out)
+		}
+	}
+	e.expectContexts(before...)
+	// The sessions must still be valid
+	e.mustRun("list", "clusters")
+
+	out = e.mustRun("logout")
+	if !strings.Contains(out, "Removed 3 context(s)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	e.expectContexts()
+}
+
+func TestRefresh(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "web", "-n", "team-a")
+	conf := e.kubeconfig()
+	before := conf.AuthInfos[conf.Contexts["web"].AuthInfo].Token
+
+	out := e.mustRun("refresh")
+	if !strings.Contains(out, "Refreshed") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	conf = e.kubeconfig()
+	if after := conf.AuthInfos[conf.Contexts["web"].AuthInfo].Token; after == before || len(after) == 0 {
+		t.Error("refresh didn't renew the token of the guest cluster context")
+	}
+
+	// A context whose user entry is gone is skipped rather than renewed
+	delete(conf.AuthInfos, conf.Contexts["web"].AuthInfo)
+	if err := clientcmd.WriteToFile(*conf, os.Getenv("KUBECONFIG")); err != nil {
+		t.Fatal(err)
+	}
+	out = e.mustRun("refresh")
+	if !strings.Contains(out, "user entry missing") {
+		t.Errorf("refresh doesn't skip the context without a user entry:\n%s", out)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "web", "db", "-n", "team-a")
+	e.srv.DeleteCluster("team-a", "db")
+
+	out := e.mustRun("prune", "--dry-run")
+	if !strings.Contains(out, "cluster team-a/db no longer exists") {
+		t.Errorf("prune --dry-run doesn't report the deleted cluster:\n%s", out)
+	}
+	e.expectContexts(e.srv.Host(), "db", "web")
+
+	e.mustRun("prune")
+	e.expectContexts(e.srv.Host(), "web")
+	conf := e.kubeconfig()
+	for name := range conf.Clusters {
+		if strings.HasPrefix(name, "db.") {
+			t.Errorf("cluster %q of the pruned context is left", name)
+		}
+	}
+
+	if out := e.mustRun("prune"); !strings.Contains(out, "Nothing to prune") {
+		t.Errorf("second prune removed more:\n%s", out)
+	}
+}
+
+func TestPruneStale(t *testing.T) {
+	e := newTestEnv(t)
+	e.mustRun("login", "web", "db", "-n", "team-a")
+	conf := e.kubeconfig()
+	conf.AuthInfos[conf.Contexts["web"].AuthInfo].Token = e.srv.IssueToken(testUser, -48*time.Hour)
+	delete(conf.Clusters, conf.Contexts["db"].Cluster)
+	orphan := "wcp:" + e.srv.Host() + ":alice"
+	conf.AuthInfos[orphan] = &api.AuthInfo{Token: "orphaned"}
+	conf.Clusters["mine"] = &api.Cluster{Server: "https://mine.local"}
+	conf.AuthInfos["me"] = &api.AuthInfo{Token: "hand-written"}
+	conf.Contexts["mine"] = &api.Context{Cluster: "mine", AuthInfo: "me"}
+	if err := clientcmd.WriteToFile(*conf, os.Getenv("KUBECONFIG")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are kept for the grace period, so that they can be renewed
+	if out := e.mustRun("prune", "--offline", "--dry-run", "--grace-period", "72h"); strings.Contains(out, "token expired") {
+		t.Errorf("token within the grace period would be pruned:\n%s", out)
+	}
+
+	out := e.mustRun("prune", "--offline", "--grace-period", "24h")
+	for _, reason := range []string{"token expired 2d", "cluster entry", "not used by any context"} {
+		if !strings.Contains(out, reason) {
+			t.Errorf("prune doesn't report %q:\n%s", reason, out)
+		}
+	}
+	e.expectContexts(e.srv.Host(), "mine")
+	conf = e.kubeconfig()
+	if _, ok := conf.AuthInfos[orphan]; ok {
+		t.Error("user entry not used by any context is left")
+	}
+	if _, ok := conf.AuthInfos["me"]; !ok {
+		t.Error("user entry created by hand was removed")
+	}
+	if _, ok := conf.Clusters["mine"]; !ok {
+		t.Error("cluster entry created by hand was removed")
+	}
+}
+
+func TestContexts(t *testing.T) {
+	e := newTestEnv(t)
+	if out := e.mustRun("contexts"); !strings.Contains(out, "Not logged in") {
+		t.Errorf("unexpected output without contexts:\n%s", out)
+	}
+
+	e.mustRun("login", "web", "-n", "team-a")
+	conf := e.kubeconfig()
+	conf.Clusters["mine"] = &api.Cluster{Server: "https://mine.local"}
+	conf.AuthInfos["me"] = &api.AuthInfo{Token: "hand-written"}
+	conf.Contexts["mine"] = &api.Context{Cluster: "mine", AuthInfo: "me"}
+	if err := clientcmd.WriteToFile(*conf, os.Getenv("KUBECONFIG")); err != nil {
+		t.Fatal(err)
+	}
+
+	var contexts []struct {
+		Name       string     `json:"name"`
+		Kind       string     `json:"kind"`
+		Supervisor string     `json:"supervisor"`
+		Namespace  string     `json:"namespace"`
+		Cluster    string     `json:"cluster"`
+		User       string     `json:"user"`
+		Credential string     `json:"credential"`
+		ExpiresAt  *time.Time `json:"expiresAt"`
+		Expired    bool       `json:"expired"`
+		Current    bool       `json:"current"`
+	}
+	if err := json.Unmarshal([]byte(e.mustRun("contexts", "-o", "json")), &contexts); err != nil {
+		t.Fatal(err)
+	}
+	if len(contexts) != 2 {
+		t.Fatalf("got %d contexts, want the supervisor and web contexts only: %+v", len(contexts), contexts)
+	}
+	for _, c := range contexts {
+		if c.User != testUser || c.Credential != "token" || c.ExpiresAt == nil || c.Expired {
+			t.Errorf("context %q has user %q, credential %q, expiry %v, expired %v", c.Name, c.User, c.Credential, c.ExpiresAt, c.Expired)
+		}
+		switch c.Name {
+		case "web":
+			if c.Kind != "guest" || c.Namespace != "team-a" || c.Cluster != "web" || c.Supervisor != e.srv.URL || !c.Current {
+				t.Errorf("guest context is described as %+v", c)
+			}
+		case e.srv.Host():
+			if c.Kind != "supervisor" || c.Current {
+				t.Errorf("supervisor context is described as %+v", c)
+			}
+		default:
+			t.Errorf("unexpected context %q", c.Name)
+		}
+	}
+
+	out := e.mustRun("contexts")
+	if !strings.Contains(out, "*") || strings.Contains(out, "mine") {
+		t.Errorf("table doesn't mark the current context, or lists the one created by hand:\n%s", out)
+	}
+	if _, err := e.run("contexts", "-o", "yaml"); err == nil {
+		t.Error("unsupported output format was accepted")
+	}
+}
+
+func TestCredentialsSet(t *testing.T) {
+	e := newTestEnv(t)
+	t.Setenv("TCLI_CREDENTIALS_PASSPHRASE", "passphrase")
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e.mustRun("credentials", "set", "--password", "", "--password-file", file)
+	if out := e.mustRun("credentials", "get"); out != "from-file\n" {
+		t.Errorf("stored password is %q, want the one of --password-file", out)
+	}
+	// A stored password is replaced rather than read back from the store
+	e.mustRun("credentials", "set", "--password", "changed")
+	if out := e.mustRun("credentials", "get"); out != "changed\n" {
+		t.Errorf("stored password is %q after changing it", out)
+	}
+	e.mustRun("credentials", "delete")
+}
+
+func TestRecordReplay(t *testing.T) {
+	e := newTestEnv(t)
+	recording := filepath.Join(t.TempDir(), "recording.jsonl")
+	// The recording is opened once per process, so both logins go to it
+	e.mustRun("login", "web", "-n", "team-a", "--record", recording)
+	e.mustRun("login", "web", "-n", "team-a", "--record", recording)
+	before := e.kubeconfig()
+	e.srv.Close()
+
+	// Replayed tokens are redacted and mustn't replace working ones
+	if _, err := e.run("login", "web", "-n", "team-a", "--replay", recording); !errors.Is(err, auth.ErrReplayKubeconfig) {
+		t.Errorf("got %v replaying without --kubeconfig, want ErrReplayKubeconfig", err)
+	}
+	if after := e.kubeconfig(); !reflect.DeepEqual(after.AuthInfos, before.AuthInfos) {
+		t.Error("replaying changed the kubeconfig")
+	}
+
+	scratch := filepath.Join(t.TempDir(), "kubeconfig")
+	e.mustRun("login", "web", "-n", "team-a", "--replay", recording, "--kubeconfig", scratch)
+	conf, err := clientcmd.LoadFromFile(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx, ok := conf.Contexts["web"]; !ok || conf.AuthInfos[ctx.AuthInfo].Token != "REDACTED" {
+		t.Errorf("replayed login didn't write the redacted token to --kubeconfig")
+	}
+}
+
+func TestUse(t *testing.T) {
+	e := newTestEnv(t)
+	// A guest cluster named like a namespace
+	e.srv.AddCluster(supervisortest.Cluster{Namespace: "team-b", Name: "team-a"})
+	e.mustRun("login", "team-a", "-n", "team-b")
+	e.mustRun("use", e.srv.Host())
+
+	if _, err := e.run("use", "team-a"); err == nil || !strings.Contains(err.Error(), "--context or --namespace") {
+		t.Errorf("got %v for a name that is both a context and a namespace, want an error", err)
+	}
+	if _, err := e.run("use", "--namespace", "missing"); err == nil {
+		t.Error("setting a missing namespace succeeded")
+	}
+	e.mustRun("use", "--namespace", "team-a")
+	if conf := e.kubeconfig(); conf.CurrentContext != e.srv.Host() || conf.Contexts[e.srv.Host()].Namespace != "team-a" {
+		t.Errorf("use --namespace left context %q with namespace %q", conf.CurrentContext, conf.Contexts[conf.CurrentContext].Namespace)
+	}
+	e.mustRun("use", "--context", "team-a")
+	if conf := e.kubeconfig(); conf.CurrentContext != "team-a" {
+		t.Errorf("use --context switched to %q", conf.CurrentContext)
+	}
+
+	e.mustRun("use", "-")
+	if conf := e.kubeconfig(); conf.CurrentContext != e.srv.Host() {
+		t.Errorf("use - switched to %q, want the supervisor context", conf.CurrentContext)
+	}
+}
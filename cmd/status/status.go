@@ -0,0 +1,93 @@
+package status
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+func NewCmdStatus() *cobra.Command {
+	c := &cobra.Command{
+		Use:     "status",
+		Aliases: []string{"whoami"},
+		Args:    cobra.NoArgs,
+		Short:   "Show the session tokens stored by tcli and when they expire",
+		Long: `Show the session tokens stored by tcli and when they expire
+
+Every context written by "tcli login" is listed together with the server,
+user and namespace it belongs to, when its session token was issued and how
+long it remains valid. Expired tokens must be renewed with "tcli login".
+
+Examples:
+	# Show all sessions
+	tcli status
+
+	Use "tcli --help" for a list of global command-line options (applies to all commands).
+	`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := auth.LoadKubeconfig()
+			if err != nil {
+				return err
+			}
+
+			contexts := auth.ManagedContexts(conf)
+			if len(contexts) == 0 {
+				fmt.Println("Not logged in. Please run 'tcli login' to authenticate")
+				return nil
+			}
+
+			now := time.Now()
+			table := &v1.Table{
+				ColumnDefinitions: []v1.TableColumnDefinition{
+					{Name: "CONTEXT", Type: "string"},
+					{Name: "SERVER", Type: "string"},
+					{Name: "USER", Type: "string"},
+					{Name: "NAMESPACE", Type: "string"},
+					{Name: "ISSUED", Type: "string"},
+					{Name: "REMAINING", Type: "string"},
+					{Name: "STATUS", Type: "string"},
+				},
+			}
+			for _, mc := range contexts {
+				issued, remaining, status := "<unknown>", "<unknown>", "Unknown"
+				if info, err := auth.ParseToken(auth.StoredToken(mc.AuthInfo)); err == nil {
+					issued, remaining, status = describeToken(info, now)
+				}
+				name := mc.Name
+				if mc.Current {
+					name = "*" + name
+				}
+				table.Rows = append(table.Rows, v1.TableRow{
+					Cells: []interface{}{name, mc.Server, mc.Username, mc.Namespace, issued, remaining, status},
+				})
+			}
+
+			printer := printers.NewTablePrinter(printers.PrintOptions{})
+			return printer.PrintObj(table, os.Stdout)
+		},
+	}
+	return c
+}
+
+// describeToken returns the issued at time, the remaining lifetime and the
+// status of a token at the given time
+func describeToken(info *auth.TokenInfo, now time.Time) (issued, remaining, status string) {
+	issued = "<unknown>"
+	if !info.IssuedAt.IsZero() {
+		issued = info.IssuedAt.Local().Format("2006-01-02 15:04")
+	}
+	switch {
+	case info.ExpiresAt.IsZero():
+		return issued, "<none>", "Valid"
+	case info.Expired(now):
+		return issued, fmt.Sprintf("expired %s ago", duration.HumanDuration(-info.Remaining(now))), "Expired"
+	default:
+		return issued, duration.HumanDuration(info.Remaining(now)), "Valid"
+	}
+}
@@ -0,0 +1,68 @@
+package use
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+)
+
+// errNoPrevious is returned by "tcli use -" when tcli use hasn't been used
+// to change the context or namespace yet
+var errNoPrevious = errors.New("no previous context to return to")
+
+// position is a context and the namespace set in it
+type position struct {
+	Context   string `json:"context"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// previousPath returns the file where the position before the last change
+// made by "tcli use" is kept
+func previousPath() (string, error) {
+	dir, err := auth.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "use-previous.json"), nil
+}
+
+func readPrevious() (position, error) {
+	var p position
+	path, err := previousPath()
+	if err != nil {
+		return p, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, errNoPrevious
+	}
+	if err != nil {
+		return p, fmt.Errorf("reading previous context: %w", err)
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(p.Context) == 0 {
+		return p, errNoPrevious
+	}
+	return p, nil
+}
+
+func writePrevious(p position) error {
+	path, err := previousPath()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
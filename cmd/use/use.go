@@ -1,50 +1,315 @@
 package use
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
 
+	"github.com/middlewaregruppen/tcli/cmd/internal/auth"
+	"github.com/middlewaregruppen/tcli/cmd/internal/completion"
+	"github.com/middlewaregruppen/tcli/cmd/internal/picker"
+	"github.com/middlewaregruppen/tcli/pkg/client"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+var (
+	contextName    string
+	tanzuNamespace string
 )
 
 func NewCmdUse() *cobra.Command {
 	c := &cobra.Command{
-		Use:   "use NAMESPACE",
-		Args:  cobra.ExactArgs(1),
-		Short: "Sets the provided namespace in the current context",
-		Long: `Sets the provided namespace in the current context 
+		Use: "use [NAMESPACE | CONTEXT | CLUSTER | -]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 && (len(contextName) > 0 || len(tanzuNamespace) > 0) {
+				return errors.New("give either an argument, --context or --namespace")
+			}
+			return cobra.MaximumNArgs(1)(cmd, args)
+		},
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			contexts, _ := completion.Contexts(cmd, args, toComplete)
+			namespaces, _ := completion.Namespaces(cmd, args, toComplete)
+			return append(contexts, namespaces...), cobra.ShellCompDirectiveNoFileComp
+		},
+		Short: "Sets the namespace of the current context, or switches to another context",
+		Long: `Sets the namespace of the current context, or switches to another context
+
+Given the name of a context written by "tcli login", or the name of a guest
+cluster that has been logged in to, the current context is switched to it.
+Otherwise the argument is a supervisor namespace to set in the current
+context, which must be a supervisor context. The namespace is checked to exist
+on the supervisor first, which takes the password like "tcli list ns". Contexts
+not written by tcli have the namespace set without checking it.
+
+A name that could be both a context and a namespace of the current context is
+refused. Use --context or --namespace to say which one is meant.
+
+"tcli use -" returns to the context and namespace used before the last change
+made by "tcli use".
+
 Examples:
 	# Use the "monitoring" namespace
 	tcli use monitoring
 
+	# Switch to the context of the guest cluster "beyonce-prod"
+	tcli use beyonce-prod
+
+	# Use the namespace "beyonce", when a guest cluster has that name too
+	tcli use --namespace beyonce
+
+	# Go back to the previous context and namespace
+	tcli use -
+
+	# Choose the namespace from a list when run in a terminal
+	tcli use
+
 	Use "tcli --help" for a list of global command-line options (applies to all commands).
 	`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			kubeconfig := viper.GetString("kubeconfig")
-			namespace := args[0]
-
-			// Read kubeconfig from file
-			conf, err := clientcmd.LoadFromFile(kubeconfig)
+			conf, err := auth.LoadKubeconfig()
 			if err != nil {
-				return fmt.Errorf("loading kubeconfig: %w", err)
+				return err
+			}
+
+			var prev position
+			if ctx, ok := conf.Contexts[conf.CurrentContext]; ok {
+				prev = position{Context: conf.CurrentContext, Namespace: ctx.Namespace}
 			}
 
-			// Update namespace in current context
-			currentCtx := conf.CurrentContext
-			if _, ok := conf.Contexts[currentCtx]; ok {
-				conf.Contexts[currentCtx].Namespace = namespace
+			var msg string
+			switch {
+			case len(args) > 0 && args[0] == "-":
+				p, err := readPrevious()
+				if err != nil {
+					return err
+				}
+				ctx, ok := conf.Contexts[p.Context]
+				if !ok {
+					return fmt.Errorf("previous context %q no longer exists", p.Context)
+				}
+				conf.CurrentContext = p.Context
+				ctx.Namespace = p.Namespace
+				msg = fmt.Sprintf("Switched to context %q", p.Context)
+				if len(p.Namespace) > 0 {
+					msg += fmt.Sprintf(" with namespace %q", p.Namespace)
+				}
+			case len(contextName) > 0:
+				mc, found, err := findContext(conf, contextName)
+				if err != nil {
+					return err
+				}
+				if !found {
+					return fmt.Errorf("%q is neither a context written by tcli nor a guest cluster that has been logged in to", contextName)
+				}
+				conf.CurrentContext = mc.Name
+				msg = fmt.Sprintf("Switched to context %q", mc.Name)
+			default:
+				target := tanzuNamespace
+				if len(args) > 0 {
+					mc, found, err := findContext(conf, args[0])
+					if err != nil {
+						return err
+					}
+					if found {
+						if err := checkNotNamespace(conf, args[0]); err != nil {
+							return err
+						}
+						conf.CurrentContext = mc.Name
+						msg = fmt.Sprintf("Switched to context %q", mc.Name)
+						break
+					}
+					target = args[0]
+				}
+				namespace, err := setNamespace(conf, target)
+				if err != nil {
+					return err
+				}
+				msg = fmt.Sprintf("Namespace set to %q in context %q", namespace, conf.CurrentContext)
 			}
 
-			// Write back to kubeconfig
-			if err := clientcmd.WriteToFile(*conf, kubeconfig); err != nil {
-				return fmt.Errorf("writing kubeconfig: %w", err)
+			// Write back to the kubeconfig file holding the context
+			if err := auth.SaveKubeconfig(conf); err != nil {
+				return err
+			}
+			if len(prev.Context) > 0 && (prev.Context != conf.CurrentContext || prev.Namespace != conf.Contexts[conf.CurrentContext].Namespace) {
+				if err := writePrevious(prev); err != nil {
+					slog.Warn("could not remember the previous context", "error", err)
+				}
 			}
 
-			fmt.Printf("Namespace set to %q in context %q\n", namespace, currentCtx)
+			fmt.Println(msg)
 			return nil
 		},
 	}
+	c.Flags().StringVar(&contextName, "context", "", "Switch to this context, or the context of this guest cluster.")
+	_ = c.RegisterFlagCompletionFunc("context", completion.Contexts)
+	c.Flags().StringVarP(&tanzuNamespace, "namespace", "n", "", "Set this namespace in the current context.")
+	_ = c.RegisterFlagCompletionFunc("namespace", completion.Namespaces)
+	c.MarkFlagsMutuallyExclusive("context", "namespace")
 	return c
 }
+
+// findContext returns the context written by "tcli login" named name, or
+// else the guest cluster context logged in to the cluster named name.
+// found is false if there is no such context.
+func findContext(conf *api.Config, name string) (mc auth.ManagedContext, found bool, err error) {
+	var matches []auth.ManagedContext
+	for _, mc := range auth.ManagedContexts(conf) {
+		if mc.Name == name {
+			return mc, true, nil
+		}
+		if info, ok := mc.Info(); ok && info.Cluster == name {
+			matches = append(matches, mc)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return mc, false, nil
+	case 1:
+		return matches[0], true, nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m.Name)
+	}
+	return mc, false, fmt.Errorf("cluster %q has been logged in to in several contexts, use one of the context names: %s", name, strings.Join(names, ", "))
+}
+
+// checkNotNamespace returns an error if name, which is the name of a context
+// or guest cluster, may also be a namespace to set in the current context.
+// Namespaces of supervisor contexts are looked up on the supervisor, while
+// those of contexts not written by tcli can't be known.
+func checkNotNamespace(conf *api.Config, name string) error {
+	if _, ok := conf.Contexts[conf.CurrentContext]; !ok {
+		return nil
+	}
+	current := currentContext(conf)
+	if current != nil && !current.Supervisor {
+		return nil
+	}
+	ambiguous := fmt.Errorf("%q is a context, but may also be a namespace of the current context %q, use --context or --namespace", name, conf.CurrentContext)
+	if current == nil {
+		return ambiguous
+	}
+
+	c, err := supervisorClient(current)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+	defer cancel()
+	err = checkNamespace(ctx, c, name)
+	switch {
+	case err == nil:
+		return ambiguous
+	case errors.Is(err, errNoNamespace):
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ambiguous, err)
+}
+
+// currentContext returns the current context if it was written by tcli
+func currentContext(conf *api.Config) *auth.ManagedContext {
+	for _, mc := range auth.ManagedContexts(conf) {
+		if mc.Current {
+			return &mc
+		}
+	}
+	return nil
+}
+
+// setNamespace sets namespace in the current context, after checking that it
+// exists on the supervisor if the current context is a supervisor context.
+// The user chooses the namespace if it is empty. The namespace is returned.
+func setNamespace(conf *api.Config, namespace string) (string, error) {
+	kubeCtx, ok := conf.Contexts[conf.CurrentContext]
+	if !ok {
+		return "", errors.New("there is no current context, log in with \"tcli login\" first")
+	}
+
+	current := currentContext(conf)
+	if current != nil && !current.Supervisor {
+		if len(namespace) == 0 {
+			return "", fmt.Errorf("the current context %q is a guest cluster context, whose namespaces tcli doesn't manage", conf.CurrentContext)
+		}
+		return "", fmt.Errorf("%q is neither a context written by tcli nor a guest cluster that has been logged in to, and the current context %q is a guest cluster context, whose namespaces tcli doesn't manage", namespace, conf.CurrentContext)
+	}
+
+	if len(namespace) == 0 || current != nil {
+		c, err := supervisorClient(current)
+		if err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("timeout"))
+		defer cancel()
+		if len(namespace) == 0 {
+			if !picker.Available() {
+				return "", errors.New("NAMESPACE is required when not running in a terminal")
+			}
+			if namespace, err = picker.Namespace(ctx, c); err != nil {
+				return "", err
+			}
+		} else if err := checkNamespace(ctx, c, namespace); err != nil {
+			return "", err
+		}
+	}
+
+	kubeCtx.Namespace = namespace
+	return namespace, nil
+}
+
+// checkNamespace returns an error if namespace isn't available to the user
+// on the supervisor
+func checkNamespace(ctx context.Context, c client.Client, namespace string) error {
+	ns, err := c.Namespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("listing namespaces: %w", err)
+	}
+	for _, n := range ns {
+		if n.Namespace == namespace {
+			return nil
+		}
+	}
+	return fmt.Errorf("namespace %q %w", namespace, errNoNamespace)
+}
+
+// errNoNamespace is returned by checkNamespace for namespaces which aren't
+// available to the user
+var errNoNamespace = errors.New("doesn't exist on the supervisor, or isn't available to you")
+
+// supervisorClient returns a client listing the namespaces on the supervisor
+// that the current context mc was logged in to, or else on --server if mc is
+// nil
+func supervisorClient(mc *auth.ManagedContext) (client.Client, error) {
+	server, username := viper.GetString("server"), viper.GetString("username")
+	if mc != nil {
+		if info, ok := mc.Info(); ok {
+			server, username = info.Server, mc.Username
+		} else if u, err := url.Parse(mc.Server); err == nil && len(u.Hostname()) > 0 {
+			// The cluster of a supervisor context is the Kubernetes API of
+			// the supervisor, which tcli talks to on the default port
+			server, username = "https://"+u.Hostname(), mc.Username
+		}
+	}
+	if len(server) == 0 {
+		if mc != nil {
+			return nil, fmt.Errorf("the supervisor of context %q is unknown, use --server", mc.Name)
+		}
+		return nil, errors.New("unknown supervisor, use --server or give NAMESPACE")
+	}
+
+	opts, err := auth.ClientOptions(server)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NamespacesClient(server, username, auth.Interactive, opts...)
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vmware-tanzu/tanzu-framework/apis/run/v1alpha2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultCacheTTL is how long cached responses are served without asking the
+// server again
+const DefaultCacheTTL = time.Minute
+
+// StaleFunc is called when a cached response is served because the server
+// can't be reached. what describes the response, age is how long ago it was
+// cached and err is why the server couldn't be reached.
+type StaleFunc func(what string, age time.Duration, err error)
+
+// CachingClient is a Client that stores the namespaces, cluster tables,
+// cluster lists and release tables it fetches as files in a directory. Responses younger than
+// the TTL of the cache are served from it without asking the server. Older
+// responses are served when the server can't be reached, after calling the
+// StaleFunc of the client. Other requests are passed on to the wrapped
+// Client.
+type CachingClient struct {
+	Client
+	dir     string
+	ttl     time.Duration
+	onStale StaleFunc
+}
+
+// CacheOption configures a CachingClient
+type CacheOption func(*CachingClient)
+
+// WithCacheTTL sets how long cached responses are served without asking the
+// server. Responses are always fetched from the server if ttl is 0.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *CachingClient) {
+		c.ttl = ttl
+	}
+}
+
+// WithStaleFunc makes the client call fn when it serves a cached response
+// because the server can't be reached
+func WithStaleFunc(fn StaleFunc) CacheOption {
+	return func(c *CachingClient) {
+		c.onStale = fn
+	}
+}
+
+// NewCachingClient returns a client caching the responses of c in dir. Since
+// responses depend on the server and on who is asking, dir must not be
+// shared by clients of different servers or users.
+func NewCachingClient(c Client, dir string, opts ...CacheOption) *CachingClient {
+	cc := &CachingClient{Client: c, dir: dir, ttl: DefaultCacheTTL}
+	for _, opt := range opts {
+		opt(cc)
+	}
+	return cc
+}
+
+func (c *CachingClient) Namespaces(ctx context.Context) ([]Namespace, error) {
+	return cached(c, "namespaces", "namespaces", func() ([]Namespace, error) {
+		return c.Client.Namespaces(ctx)
+	})
+}
+
+func (c *CachingClient) Clusters(ctx context.Context, ns string) (*v1.Table, error) {
+	return cached(c, "clusters-"+ns, "clusters in namespace "+ns, func() (*v1.Table, error) {
+		return c.Client.Clusters(ctx, ns)
+	})
+}
+
+// ClusterList caches the clusters in namespace ns. Lists filtered by a label
+// selector are always fetched from the server.
+func (c *CachingClient) ClusterList(ctx context.Context, ns, selector string) (*v1alpha2.TanzuKubernetesClusterList, error) {
+	if len(selector) > 0 {
+		return c.Client.ClusterList(ctx, ns, selector)
+	}
+	return cached(c, "clusterlist-"+ns, "clusters in namespace "+ns, func() (*v1alpha2.TanzuKubernetesClusterList, error) {
+		return c.Client.ClusterList(ctx, ns, selector)
+	})
+}
+
+func (c *CachingClient) ReleasesTable(ctx context.Context) (*v1.Table, error) {
+	return cached(c, "releases", "releases", func() (*v1.Table, error) {
+		return c.Client.ReleasesTable(ctx)
+	})
+}
+
+// cacheEntry is a response stored on disk
+type cacheEntry[T any] struct {
+	Created time.Time `json:"created"`
+	Value   T         `json:"value"`
+}
+
+// cached returns the response cached under name if it is younger than the
+// TTL of c, or else calls fetch and caches its response. If the server can't
+// be reached, an older cached response is returned instead.
+func cached[T any](c *CachingClient, name, what string, fetch func() (T, error)) (T, error) {
+	path := filepath.Join(c.dir, name+".json")
+	var entry cacheEntry[T]
+	found := false
+	if b, err := os.ReadFile(path); err == nil {
+		found = json.Unmarshal(b, &entry) == nil
+	}
+	if found && time.Since(entry.Created) < c.ttl {
+		return entry.Value, nil
+	}
+
+	v, err := fetch()
+	if err != nil {
+		if found && Unreachable(err) {
+			if c.onStale != nil {
+				c.onStale(what, time.Since(entry.Created), err)
+			}
+			return entry.Value, nil
+		}
+		return v, err
+	}
+
+	// Failing to cache the response only means that it can't be served
+	// from the cache later
+	_ = writeCacheEntry(path, cacheEntry[T]{Created: time.Now(), Value: v})
+	return v, nil
+}
+
+// writeCacheEntry replaces the file at path with entry, by writing it to a
+// temporary file first so that other processes never read a partial entry
+func writeCacheEntry[T any](path string, entry cacheEntry[T]) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Unreachable reports whether err means that the server couldn't be
+// reached, rather than that it rejected the request
+func Unreachable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
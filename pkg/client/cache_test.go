@@ -0,0 +1,129 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+)
+
+// namespacesClient is a Client serving the namespaces in ns, or err
+type namespacesClient struct {
+	client.Client
+	ns    []client.Namespace
+	err   error
+	calls int
+}
+
+func (c *namespacesClient) Namespaces(context.Context) ([]client.Namespace, error) {
+	c.calls++
+	return c.ns, c.err
+}
+
+var errRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func TestCachingClientTTL(t *testing.T) {
+	dir := t.TempDir()
+	fake := &namespacesClient{ns: []client.Namespace{{Namespace: "team-a"}}}
+	c := client.NewCachingClient(fake, dir)
+
+	for i := 0; i < 2; i++ {
+		ns, err := c.Namespaces(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ns) != 1 || ns[0].Namespace != "team-a" {
+			t.Errorf("call %d returned %v", i+1, ns)
+		}
+	}
+	if fake.calls != 1 {
+		t.Errorf("server was asked %d times within the TTL, want 1", fake.calls)
+	}
+
+	// Without a TTL the server is always asked
+	c = client.NewCachingClient(fake, dir, client.WithCacheTTL(0))
+	if _, err := c.Namespaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fake.calls != 2 {
+		t.Errorf("server was asked %d times, want 2", fake.calls)
+	}
+}
+
+func TestCachingClientStale(t *testing.T) {
+	dir := t.TempDir()
+	fake := &namespacesClient{ns: []client.Namespace{{Namespace: "team-a"}}}
+	if _, err := client.NewCachingClient(fake, dir).Namespaces(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var staleErr error
+	c := client.NewCachingClient(fake, dir, client.WithCacheTTL(0), client.WithStaleFunc(func(what string, age time.Duration, err error) {
+		staleErr = err
+	}))
+
+	// An unreachable server is answered from the cache
+	fake.err = fmt.Errorf("listing namespaces: %w", errRefused)
+	ns, err := c.Namespaces(context.Background())
+	if err != nil {
+		t.Fatalf("stale response wasn't served: %v", err)
+	}
+	if len(ns) != 1 || ns[0].Namespace != "team-a" {
+		t.Errorf("stale response is %v", ns)
+	}
+	if !errors.Is(staleErr, errRefused) {
+		t.Errorf("stale func got %v, want the connection error", staleErr)
+	}
+
+	// Rejected requests aren't
+	staleErr = nil
+	fake.err = errors.New("401 Unauthorized")
+	if _, err := c.Namespaces(context.Background()); err == nil {
+		t.Error("stale response served although the server rejected the request")
+	}
+	if staleErr != nil {
+		t.Error("stale func called although the server rejected the request")
+	}
+
+	// Nothing can be served without a cached response
+	c = client.NewCachingClient(fake, t.TempDir())
+	fake.err = errRefused
+	if _, err := c.Namespaces(context.Background()); !errors.Is(err, errRefused) {
+		t.Errorf("got %v without a cached response, want the connection error", err)
+	}
+}
+
+// timeoutError is a net.Error timing out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", errRefused, true},
+		{"wrapped by url.Error", &url.Error{Op: "Get", URL: "https://supervisor.local", Err: errRefused}, true},
+		{"timeout", &url.Error{Op: "Get", URL: "https://supervisor.local", Err: timeoutError{}}, true},
+		{"deadline exceeded", fmt.Errorf("listing: %w", context.DeadlineExceeded), true},
+		{"rejected", errors.New("401 Unauthorized"), false},
+		{"canceled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.Unreachable(tt.err); got != tt.want {
+				t.Errorf("Unreachable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,17 +4,20 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"sort"
 	"time"
 
 	"github.com/vmware-tanzu/tanzu-framework/apis/run/v1alpha2"
+	"golang.org/x/net/http/httpproxy"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -36,6 +39,17 @@ type RestClient struct {
 	auth       Credentials
 	Token      string
 	logger     *slog.Logger
+	recorder   io.Writer
+	replayer   *Replayer
+	reauth     Reauthenticator
+	// transport is the transport owned by this client, cloned from the
+	// configured http client the first time an option modifies it
+	transport *http.Transport
+	// proxyTLSConfig is the TLS configuration of the configured http client,
+	// before options changed it for the server. It is used for connections
+	// to https proxies.
+	proxyTLSConfig *tls.Config
+	err            error
 }
 
 type Credentials interface {
@@ -73,6 +87,10 @@ func BasicCredentials(username, password string) Credentials {
 
 type Option func(*RestClient)
 
+// Reauthenticator obtains new credentials after the server has rejected the
+// current ones, typically by logging in to the supervisor again
+type Reauthenticator func(ctx context.Context) (Credentials, error)
+
 type LoginResponse struct {
 	SessionID string `json:"session_id,omitempty"`
 }
@@ -93,29 +111,164 @@ type Namespace struct {
 func WithClient(c *http.Client) Option {
 	return func(r *RestClient) {
 		r.httpClient = c
+		r.transport = nil
 	}
 }
 
 func WithInsecure(insecure bool) Option {
 	return func(rc *RestClient) {
-		if rc.httpClient == nil {
-			rc.httpClient = &http.Client{}
-		}
+		rc.ownTransport().TLSClientConfig.InsecureSkipVerify = insecure
+	}
+}
 
-		baseTransport := rc.httpClient.Transport
-		if baseTransport == nil {
-			baseTransport = http.DefaultTransport
+// WithCA makes the client verify the server certificate against the PEM
+// encoded CA certificates in caPEM instead of the system roots
+func WithCA(caPEM []byte) Option {
+	return func(rc *RestClient) {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			rc.err = errors.New("no valid PEM encoded certificates found in CA bundle")
+			return
 		}
+		rc.ownTransport().TLSClientConfig.RootCAs = pool
+	}
+}
+
+// WithTLSServerName sets the server name used to verify the server
+// certificate, for when it differs from the host name in the server URL
+func WithTLSServerName(name string) Option {
+	return func(rc *RestClient) {
+		rc.ownTransport().TLSClientConfig.ServerName = name
+	}
+}
+
+// WithVerifyConnection replaces the default certificate verification of the
+// client with fn, which is responsible for verifying the certificate chain
+// presented by the server. See [tls.Config.VerifyConnection].
+func WithVerifyConnection(fn func(tls.ConnectionState) error) Option {
+	return func(rc *RestClient) {
+		tlsConfig := rc.ownTransport().TLSClientConfig
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = fn
+	}
+}
 
-		transport := baseTransport.(*http.Transport).Clone()
-		if transport.TLSClientConfig == nil {
-			transport.TLSClientConfig = &tls.Config{}
+// WithProxy makes the client connect to the server through the proxy at
+// proxyURL, which must use the http, https or socks5 scheme. Hosts matched by
+// NO_PROXY bypass the proxy. Without this option the proxy is taken from the
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables. The certificate
+// of an https proxy is verified using the http client given by WithClient,
+// regardless of the options for the server certificate.
+func WithProxy(proxyURL string) Option {
+	return func(rc *RestClient) {
+		u, err := ParseProxyURL(proxyURL)
+		if err != nil {
+			rc.err = err
+			return
+		}
+		config := httpproxy.FromEnvironment()
+		config.HTTPProxy = u.String()
+		config.HTTPSProxy = u.String()
+		proxyFunc := config.ProxyFunc()
+		rc.ownTransport().Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
 		}
-		transport.TLSClientConfig.InsecureSkipVerify = insecure
-		rc.httpClient.Transport = transport
 	}
 }
 
+// ParseProxyURL parses the URL of a proxy and checks that its scheme is
+// supported
+func ParseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxyURL)
+	}
+	return u, nil
+}
+
+// ownTransport returns the transport of the client, cloning the transport of
+// the configured http client the first time it is called so that options
+// never modify transports shared with other clients
+func (rc *RestClient) ownTransport() *http.Transport {
+	if rc.transport != nil {
+		return rc.transport
+	}
+	if rc.httpClient == nil {
+		rc.httpClient = &http.Client{}
+	}
+
+	baseTransport := rc.httpClient.Transport
+	if baseTransport == nil {
+		baseTransport = http.DefaultTransport
+	}
+
+	transport := baseTransport.(*http.Transport).Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	rc.proxyTLSConfig = transport.TLSClientConfig.Clone()
+	httpClient := *rc.httpClient
+	httpClient.Transport = transport
+	rc.httpClient = &httpClient
+	rc.transport = transport
+	return transport
+}
+
+// dialTLS opens TLS connections for the transport owned by the client.
+// Connections to the server use the TLS configuration of the transport, while
+// connections to anything else, which are https proxies, use the TLS
+// configuration of the http client the transport was cloned from.
+func (rc *RestClient) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := rc.proxyTLSConfig.Clone()
+	if addr == rc.serverAddr() {
+		config = rc.transport.TLSClientConfig.Clone()
+	}
+	if len(config.ServerName) == 0 {
+		config.ServerName = host
+	}
+
+	dial := rc.transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d := rc.transport.TLSHandshakeTimeout; d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// serverAddr returns the host:port of the server
+func (rc *RestClient) serverAddr() string {
+	port := rc.uri.Port()
+	if len(port) == 0 {
+		port = "443"
+	}
+	return net.JoinHostPort(rc.uri.Hostname(), port)
+}
+
 func WithCredentials(creds Credentials) Option {
 	return func(rc *RestClient) {
 		rc.auth = creds
@@ -128,13 +281,71 @@ func WithLogger(l *slog.Logger) Option {
 	}
 }
 
+// WithRecorder makes the client write every request and response to w as
+// JSON lines, with credentials and session tokens redacted
+func WithRecorder(w io.Writer) Option {
+	return func(rc *RestClient) {
+		rc.recorder = w
+	}
+}
+
+// WithReplayer makes the client serve responses from rp instead of the network
+func WithReplayer(rp *Replayer) Option {
+	return func(rc *RestClient) {
+		rc.replayer = rp
+	}
+}
+
+// WithReauthenticator makes the client call fn to obtain new credentials when
+// a request is rejected as unauthorized. The request is retried once with the
+// new credentials, which are used for all subsequent requests.
+func WithReauthenticator(fn Reauthenticator) Option {
+	return func(rc *RestClient) {
+		rc.reauth = fn
+	}
+}
+
 func (r *RestClient) SetToken(t string) *RestClient {
 	r.Token = t
 	return r
 }
 
-// DoRequest applies options and then performs the http request
+// DoRequest applies options and then performs the http request. If the
+// request is rejected as unauthorized and the client has a Reauthenticator,
+// the request is retried once with new credentials.
 func (r *RestClient) DoRequest(req *http.Request) (*http.Response, error) {
+	res, err := r.do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || r.reauth == nil {
+		return res, err
+	}
+
+	r.logger.Debug("request unauthorized, authenticating again",
+		"method", req.Method,
+		"url", req.URL.String(),
+	)
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	creds, err := r.reauth(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("authenticating again: %w", err)
+	}
+	r.auth = creds
+
+	retry := req.Clone(req.Context())
+	retry.Header.Del("Authorization")
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return r.do(retry)
+}
+
+// do applies credentials to req and performs it
+func (r *RestClient) do(req *http.Request) (*http.Response, error) {
 	if r.auth != nil {
 		if err := r.auth.Apply(req); err != nil {
 			r.logger.Debug("error applying credentials to request",
@@ -147,7 +358,7 @@ func (r *RestClient) DoRequest(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	req.Header.Add("Content-Type", "application/json")
+	req.Header.Set("Content-Type", "application/json")
 	start := time.Now()
 
 	res, err := r.httpClient.Do(req)
@@ -258,6 +469,45 @@ func (r *RestClient) Clusters(ctx context.Context, ns string) (*v1.Table, error)
 	return &clusterlist, nil
 }
 
+// ClusterList returns the clusters in namespace ns. If selector isn't empty
+// only clusters whose labels match the label selector are returned.
+func (r *RestClient) ClusterList(ctx context.Context, ns, selector string) (*v1alpha2.TanzuKubernetesClusterList, error) {
+	if len(ns) == 0 {
+		ns = "default"
+	}
+
+	u, err := r.getRequestURI(fmt.Sprintf(PathTanzuKubernetesClusters, ns))
+	if err != nil {
+		return nil, err
+	}
+	if len(selector) > 0 {
+		u.RawQuery = url.Values{"labelSelector": {selector}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.DoRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := r.handleResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters v1alpha2.TanzuKubernetesClusterList
+	err = json.Unmarshal(body, &clusters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusters, nil
+}
+
 func (r *RestClient) ReleasesTable(ctx context.Context) (*v1.Table, error) {
 	u, err := r.getRequestURI(PathTanzuKubernetesReleases)
 	if err != nil {
@@ -492,6 +742,34 @@ func New(baseURI string, opts ...Option) (Client, error) {
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	// net/http handshakes with https proxies using the TLS configuration
+	// meant for the server, which would verify the proxy certificate as the
+	// server certificate
+	if c.transport != nil && c.transport.DialTLSContext == nil {
+		c.transport.DialTLSContext = c.dialTLS
+	}
+
+	// Recording and replaying wrap whatever transport the other options
+	// configured, so they are applied last
+	if c.replayer != nil || c.recorder != nil {
+		transport := c.httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		if c.replayer != nil {
+			transport = c.replayer
+		}
+		if c.recorder != nil {
+			transport = &recordingTransport{next: transport, w: c.recorder}
+		}
+		httpClient := *c.httpClient
+		httpClient.Transport = transport
+		c.httpClient = &httpClient
+	}
 
 	return c, nil
 }
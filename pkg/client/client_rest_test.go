@@ -0,0 +1,182 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/middlewaregruppen/tcli/pkg/trust"
+)
+
+// newConnectProxy starts an https proxy with its own certificate, which
+// tunnels CONNECT requests for any host to target. The proxy is trusted by
+// the returned pool, and connects counts the tunnels it opened.
+func newConnectProxy(t *testing.T, target string, connects *int32) (*httptest.Server, *x509.CertPool) {
+	t.Helper()
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt32(connects, 1)
+		w.WriteHeader(http.StatusOK)
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, buf)
+			upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		conn.Close()
+	}))
+
+	cert, pool := localhostCert(t)
+	proxy.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	proxy.StartTLS()
+	t.Cleanup(proxy.Close)
+	return proxy, pool
+}
+
+// localhostCert returns a self-signed certificate for 127.0.0.1 and a pool
+// trusting it
+func localhostCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// TestHTTPSProxyTrustOnFirstUse checks that the certificate of an https proxy
+// is neither checked against nor pinned as the certificate of the supervisor
+func TestHTTPSProxyTrustOnFirstUse(t *testing.T) {
+	supervisor := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, "[]")
+	}))
+	defer supervisor.Close()
+
+	var connects int32
+	proxy, proxyRoots := newConnectProxy(t, supervisor.Listener.Addr().String(), &connects)
+
+	// Loopback addresses bypass proxies, so the supervisor is given a name
+	// which only the proxy resolves
+	u, err := url.Parse(supervisor.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := "https://supervisor.test:" + u.Port()
+	host := "supervisor.test:" + u.Port()
+
+	store, err := trust.Load(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompted []string
+	prompt := func(host string, chain []*x509.Certificate, verifyErr error) (bool, error) {
+		prompted = append(prompted, trust.Fingerprint(chain[0]))
+		return true, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		c, err := client.New(server,
+			client.WithClient(&http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: proxyRoots},
+			}}),
+			client.WithProxy(proxy.URL),
+			client.WithVerifyConnection(store.VerifyConnection(host, "", nil, prompt)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Namespaces(context.Background()); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&connects); n != 2 {
+		t.Errorf("proxy opened %d tunnels, want 2", n)
+	}
+	want := trust.Fingerprint(supervisor.Certificate())
+	if len(prompted) != 1 || prompted[0] != want {
+		t.Errorf("asked to trust %v, want only the supervisor certificate %s", prompted, want)
+	}
+	if pin, ok := store.Get(host); !ok || pin.Fingerprint != want {
+		t.Errorf("pinned %q for %s, want the supervisor certificate %s", pin.Fingerprint, host, want)
+	}
+}
+
+// TestHTTPSProxyUntrusted checks that the certificate of an https proxy is
+// still verified when the supervisor certificate is checked by
+// WithVerifyConnection
+func TestHTTPSProxyUntrusted(t *testing.T) {
+	supervisor := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "[]")
+	}))
+	defer supervisor.Close()
+
+	var connects int32
+	proxy, _ := newConnectProxy(t, supervisor.Listener.Addr().String(), &connects)
+
+	u, err := url.Parse(supervisor.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.New("https://supervisor.test:"+u.Port(),
+		client.WithClient(&http.Client{Transport: &http.Transport{}}),
+		client.WithProxy(proxy.URL),
+		client.WithVerifyConnection(func(tls.ConnectionState) error { return nil }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Namespaces(context.Background()); err == nil {
+		t.Error("connected through a proxy with an untrusted certificate")
+	}
+	if n := atomic.LoadInt32(&connects); n != 0 {
+		t.Errorf("proxy opened %d tunnels, want 0", n)
+	}
+}
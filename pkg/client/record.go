@@ -0,0 +1,241 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+var (
+	// ErrNoRecording is returned by a Replayer when a request has no matching
+	// recorded response
+	ErrNoRecording = errors.New("no recorded response")
+
+	redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	redactedFields  = map[string]bool{
+		"password":      true,
+		"session_id":    true,
+		"token":         true,
+		"access_token":  true,
+		"refresh_token": true,
+		"id_token":      true,
+	}
+)
+
+// Exchange is a recorded HTTP request and its response. Exchanges are written
+// as JSON lines by [WithRecorder] and served by a [Replayer].
+type Exchange struct {
+	Time           time.Time     `json:"time"`
+	Duration       time.Duration `json:"duration"`
+	Method         string        `json:"method"`
+	URL            string        `json:"url"`
+	RequestHeader  http.Header   `json:"request_header,omitempty"`
+	RequestBody    string        `json:"request_body,omitempty"`
+	StatusCode     int           `json:"status_code,omitempty"`
+	ResponseHeader http.Header   `json:"response_header,omitempty"`
+	ResponseBody   string        `json:"response_body,omitempty"`
+	// Error is set when the request failed without a response, for example
+	// because of a TLS handshake failure
+	Error string `json:"error,omitempty"`
+}
+
+// recordingTransport writes every request and response passing through it to
+// w, with credentials and session tokens redacted
+type recordingTransport struct {
+	next http.RoundTripper
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ex := Exchange{
+		Time:          time.Now(),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: redactHeader(req.Header),
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		ex.RequestBody = redactBody(body)
+	}
+
+	res, err := t.next.RoundTrip(req)
+	ex.Duration = time.Since(ex.Time)
+	if err != nil {
+		ex.Error = err.Error()
+		return nil, errors.Join(err, t.write(ex))
+	}
+
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	ex.StatusCode = res.StatusCode
+	ex.ResponseHeader = redactHeader(res.Header)
+	ex.ResponseBody = redactBody(body)
+
+	if err := t.write(ex); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (t *recordingTransport) write(ex Exchange) error {
+	b, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("recording http exchange: %w", err)
+	}
+	return nil
+}
+
+// Replayer is an http.RoundTripper that serves responses from recorded
+// exchanges instead of the network. Requests are matched on method, path and
+// query in the order they were recorded. A Replayer may be shared between
+// clients so that recordings spanning several clients replay in order.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+// NewReplayer reads exchanges, one JSON document per line, from r
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("parsing recording line %d: %w", line, err)
+		}
+		rp.exchanges = append(rp.exchanges, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	rp.used = make([]bool, len(rp.exchanges))
+	return rp, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (rp *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	ex, err := rp.next(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(ex.Error) > 0 {
+		return nil, errors.New(ex.Error)
+	}
+	header := ex.ResponseHeader
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ex.StatusCode, http.StatusText(ex.StatusCode)),
+		StatusCode:    ex.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(ex.ResponseBody)),
+		ContentLength: int64(len(ex.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// next returns the first unused exchange matching req and marks it used
+func (rp *Replayer) next(req *http.Request) (*Exchange, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	for i, ex := range rp.exchanges {
+		if rp.used[i] || ex.Method != req.Method {
+			continue
+		}
+		if !sameRequestURI(ex.URL, req) {
+			continue
+		}
+		rp.used[i] = true
+		return &rp.exchanges[i], nil
+	}
+	return nil, fmt.Errorf("%w for %s %s", ErrNoRecording, req.Method, req.URL.RequestURI())
+}
+
+// sameRequestURI reports whether the recorded URL has the same path and
+// query as req. The host is ignored so that recordings can be replayed
+// against any server address.
+func sameRequestURI(recorded string, req *http.Request) bool {
+	r, err := http.NewRequest(http.MethodGet, recorded, nil)
+	if err != nil {
+		return false
+	}
+	return r.URL.RequestURI() == req.URL.RequestURI()
+}
+
+func redactHeader(h http.Header) http.Header {
+	res := h.Clone()
+	for _, k := range redactedHeaders {
+		if len(res.Values(k)) > 0 {
+			res.Set(k, redacted)
+		}
+	}
+	return res
+}
+
+// redactBody replaces the values of credential fields in JSON bodies.
+// Bodies that aren't JSON are returned as is.
+func redactBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	b, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(b)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if redactedFields[strings.ToLower(k)] {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactValue(t[i])
+		}
+	}
+	return v
+}
@@ -0,0 +1,125 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+)
+
+// newRecordedServer returns a server handing out the session ids in order,
+// and answering cluster lists with an empty list
+func newRecordedServer(t *testing.T, sessions ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == client.PathWCPLogin {
+			w.Header().Set("Set-Cookie", "vmware-api-session-id="+sessions[0])
+			_, _ = io.WriteString(w, `{"session_id":"`+sessions[0]+`","user":{"name":"bob","password":"nested-secret"}}`)
+			sessions = sessions[1:]
+			return
+		}
+		_, _ = io.WriteString(w, `{"items":[]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRecordRedacts(t *testing.T) {
+	srv := newRecordedServer(t, "secret-session")
+	var recording bytes.Buffer
+	c, err := client.New(srv.URL, client.WithCredentials(client.BasicCredentials("bob", "hunter2")), client.WithRecorder(&recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := c.Login(context.Background(), "bob", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.SessionID != "secret-session" {
+		t.Errorf("recording changed the session id seen by the client to %q", sess.SessionID)
+	}
+
+	basic := base64.StdEncoding.EncodeToString([]byte("bob:hunter2"))
+	for _, secret := range []string{"hunter2", basic, "secret-session", "nested-secret"} {
+		if strings.Contains(recording.String(), secret) {
+			t.Errorf("recording contains %q:\n%s", secret, recording.String())
+		}
+	}
+
+	var ex client.Exchange
+	if err := json.Unmarshal(recording.Bytes(), &ex); err != nil {
+		t.Fatal(err)
+	}
+	if got := ex.RequestHeader.Get("Authorization"); got != "REDACTED" {
+		t.Errorf("Authorization header recorded as %q", got)
+	}
+	if got := ex.ResponseHeader.Get("Set-Cookie"); got != "REDACTED" {
+		t.Errorf("Set-Cookie header recorded as %q", got)
+	}
+	if !strings.Contains(ex.ResponseBody, `"name":"bob"`) {
+		t.Errorf("fields other than credentials were redacted: %s", ex.ResponseBody)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	srv := newRecordedServer(t, "first", "second")
+	var recording bytes.Buffer
+	c, err := client.New(srv.URL, client.WithRecorder(&recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := c.Login(ctx, "bob", "hunter2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.ClusterList(ctx, "team-a", "env=prod"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	recording.WriteString(`{"method":"GET","url":"https://supervisor.local/wcp/workloads","error":"tls: handshake failure"}` + "\n")
+
+	rp, err := client.NewReplayer(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The host of the recording doesn't matter
+	c, err = client.New("https://replayed.invalid", client.WithReplayer(rp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests are matched on path and query, in the order recorded
+	if _, err := c.ClusterList(ctx, "team-a", "env=dev"); !errors.Is(err, client.ErrNoRecording) {
+		t.Errorf("got %v for a request with another query, want ErrNoRecording", err)
+	}
+	if _, err := c.ClusterList(ctx, "team-a", "env=prod"); err != nil {
+		t.Errorf("recorded cluster list wasn't replayed: %v", err)
+	}
+	// Each recorded login is replayed once, with its redacted session id
+	for i := 0; i < 2; i++ {
+		sess, err := c.Login(ctx, "bob", "hunter2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sess.SessionID != "REDACTED" {
+			t.Errorf("replayed session id is %q, want REDACTED", sess.SessionID)
+		}
+	}
+	if _, err := c.Login(ctx, "bob", "hunter2"); !errors.Is(err, client.ErrNoRecording) {
+		t.Errorf("got %v once the recorded logins were used, want ErrNoRecording", err)
+	}
+	if _, err := c.Namespaces(ctx); err == nil || !strings.Contains(err.Error(), "handshake failure") {
+		t.Errorf("got %v, want the recorded error", err)
+	}
+}
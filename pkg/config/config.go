@@ -0,0 +1,198 @@
+// Package config reads and writes the tcli configuration file, which holds
+// named profiles of flag values. A profile lets users switch between
+// supervisors without juggling TCLI_* environment variables.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the configuration file in the tcli configuration
+// directory
+const FileName = "config.yaml"
+
+var (
+	// ErrProfileNotFound is returned when a profile doesn't exist in the
+	// configuration file
+	ErrProfileNotFound = errors.New("profile not found")
+	// ErrUnknownKey is returned when setting a key that profiles don't support
+	ErrUnknownKey = errors.New("unknown profile key")
+)
+
+// Key is a setting that can be stored in a profile. Keys are named after the
+// command line flags they provide a value for.
+type Key struct {
+	Name        string
+	Description string
+	// Path is true for keys holding file paths, in which a leading ~ is
+	// expanded to the home directory
+	Path bool
+}
+
+// Keys are the settings supported by profiles
+var Keys = []Key{
+	{Name: "server", Description: "Address of the supervisor"},
+	{Name: "username", Description: "Username to authenticate"},
+	{Name: "insecure", Description: "Skip certificate verification (true or false)"},
+	{Name: "certificate-authority", Description: "Path to a PEM encoded CA bundle of the supervisor", Path: true},
+	{Name: "tls-server-name", Description: "Server name used to verify the supervisor certificate"},
+	{Name: "proxy", Description: "URL of an http, https or socks5 proxy to the supervisor"},
+	{Name: "namespace", Description: "Default supervisor namespace"},
+	{Name: "context-name", Description: "Template for the names of cluster contexts, such as {{.Namespace}}/{{.Cluster}}"},
+	{Name: "kubeconfig", Description: "Path to the kubeconfig file", Path: true},
+	{Name: "kubeconfig-backups", Description: "Number of kubeconfig backups to keep"},
+	{Name: "credential-store", Description: "Credential store used to look up passwords"},
+	{Name: "auto-login", Description: "Log in again automatically when the session has expired (true or false)"},
+	{Name: "timeout", Description: "How long to wait for an operation, such as 30s"},
+}
+
+// LookupKey returns the key named name
+func LookupKey(name string) (Key, bool) {
+	for _, k := range Keys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+// Profile is a named set of settings
+type Profile map[string]string
+
+// Config is the content of the configuration file
+type Config struct {
+	// CurrentProfile is used when no profile is given by --profile or
+	// TCLI_PROFILE
+	CurrentProfile string             `yaml:"current-profile,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// Load reads the configuration file at path. A missing file results in an
+// empty configuration.
+func Load(path string) (*Config, error) {
+	c := &Config{Profiles: map[string]Profile{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if c.Profiles == nil {
+		c.Profiles = map[string]Profile{}
+	}
+	return c, nil
+}
+
+// Save writes c to the configuration file at path
+func (c *Config) Save(path string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Marshal returns c as YAML
+func (c *Config) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// Profile returns the profile called name
+func (c *Config) Profile(name string) (Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, valid profiles are %v", ErrProfileNotFound, name, c.ProfileNames())
+	}
+	return p, nil
+}
+
+// ProfileNames returns the names of all profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set sets key to value in the profile called name, creating the profile if
+// it doesn't exist. An empty value removes the key from the profile.
+func (c *Config) Set(name, key, value string) error {
+	if _, ok := LookupKey(key); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, key)
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		p = Profile{}
+		c.Profiles[name] = p
+	}
+	if len(value) == 0 {
+		delete(p, key)
+		return nil
+	}
+	p[key] = value
+	return nil
+}
+
+// DeleteProfile removes the profile called name. If it was the current
+// profile, no profile is current afterwards.
+func (c *Config) DeleteProfile(name string) error {
+	if _, err := c.Profile(name); err != nil {
+		return err
+	}
+	delete(c.Profiles, name)
+	if c.CurrentProfile == name {
+		c.CurrentProfile = ""
+	}
+	return nil
+}
+
+// Settings returns the settings of p with paths expanded, suitable for
+// merging into viper
+func (p Profile) Settings() map[string]interface{} {
+	res := make(map[string]interface{}, len(p))
+	for k, v := range p {
+		if key, ok := LookupKey(k); ok && key.Path {
+			v = expandHome(v)
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,85 @@
+// Package credstore stores supervisor passwords so that users don't have to
+// type them, or keep them in environment variables, every time they log in.
+// Passwords are kept by a Backend, keyed by supervisor host and username.
+package credstore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned by a Backend when there is no password stored
+	// for the requested server and username
+	ErrNotFound = errors.New("credentials not found")
+
+	mu        sync.Mutex
+	factories = map[string]Factory{}
+)
+
+// Key identifies a stored password
+type Key struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+}
+
+// Backend is implemented by credential stores
+type Backend interface {
+	// Get returns the password stored for server and username, or ErrNotFound
+	Get(server, username string) (string, error)
+	// Set stores password for server and username, replacing any existing one
+	Set(server, username, password string) error
+	// Delete removes the password stored for server and username, or returns
+	// ErrNotFound
+	Delete(server, username string) error
+	// List returns the keys of all stored passwords
+	List() ([]Key, error)
+}
+
+// Options are passed to a Factory when opening a backend
+type Options struct {
+	// Dir is the tcli configuration directory, where file based backends
+	// keep their data
+	Dir string
+	// Passphrase returns the passphrase used to encrypt the store. It is only
+	// called by backends that need one, and only when the store is accessed.
+	// create is true if the store doesn't exist yet, so that a new
+	// passphrase is being chosen and should be confirmed.
+	Passphrase func(create bool) ([]byte, error)
+}
+
+// Factory creates a Backend
+type Factory func(opts Options) (Backend, error)
+
+// Register makes a backend available under name. It is typically called from
+// the init function of the package implementing the backend.
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = f
+}
+
+// Backends returns the names of all registered backends
+func Backends() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates the backend registered under name
+func Open(name string, opts Options) (Backend, error) {
+	mu.Lock()
+	f, ok := factories[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown credential store %q, valid stores are %v", name, Backends())
+	}
+	return f(opts)
+}
@@ -0,0 +1,287 @@
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// FileBackendName is the name of the default, file based backend
+	FileBackendName = "file"
+	// FileName is the name of the file used by the file backend
+	FileName = "credentials.enc"
+
+	fileVersion = 1
+	keyLen      = 32
+	saltLen     = 16
+	scryptN     = 1 << 15
+	scryptR     = 8
+	scryptP     = 1
+
+	// Limits of the scrypt parameters read from the store file, so that a
+	// corrupted file can't make tcli allocate gigabytes of memory. scrypt
+	// needs 128*N*R bytes.
+	maxScryptN      = 1 << 20
+	maxScryptMemory = 256 << 20
+	maxScryptP      = 16
+)
+
+// ErrWrongPassphrase is returned by the file backend when the store can't be
+// decrypted with the given passphrase
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted credential store")
+
+func init() {
+	Register(FileBackendName, func(opts Options) (Backend, error) {
+		if opts.Passphrase == nil {
+			return nil, errors.New("the file credential store requires a passphrase")
+		}
+		return NewFileBackend(filepath.Join(opts.Dir, FileName), opts.Passphrase), nil
+	})
+}
+
+// encryptedFile is the on-disk format of the file backend. The entries are
+// encrypted with AES-256-GCM using a key derived from the passphrase with
+// scrypt.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type entry struct {
+	Key
+	Password string `json:"password"`
+}
+
+// FileBackend is a Backend storing passwords in a passphrase encrypted file
+type FileBackend struct {
+	path       string
+	passphrase func(create bool) ([]byte, error)
+
+	mu     sync.Mutex
+	secret []byte
+}
+
+// NewFileBackend returns a backend storing passwords in the file at path,
+// encrypted with the passphrase returned by passphrase. The file is created
+// the first time a password is stored, in which case passphrase is called
+// with create set to true.
+func NewFileBackend(path string, passphrase func(create bool) ([]byte, error)) *FileBackend {
+	return &FileBackend{path: path, passphrase: passphrase}
+}
+
+// Exists reports whether the store file has been created
+func (f *FileBackend) Exists() bool {
+	_, err := os.Stat(f.path)
+	return err == nil
+}
+
+func (f *FileBackend) Get(server, username string) (string, error) {
+	entries, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.Server == server && e.Username == username {
+			return e.Password, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (f *FileBackend) Set(server, username, password string) error {
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i, e := range entries {
+		if e.Server == server && e.Username == username {
+			entries[i].Password = password
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, entry{Key: Key{Server: server, Username: username}, Password: password})
+	}
+	return f.save(entries)
+}
+
+func (f *FileBackend) Delete(server, username string) error {
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.Server == server && e.Username == username {
+			return f.save(append(entries[:i], entries[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+func (f *FileBackend) List() ([]Key, error) {
+	entries, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]Key, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Server != keys[j].Server {
+			return keys[i].Server < keys[j].Server
+		}
+		return keys[i].Username < keys[j].Username
+	})
+	return keys, nil
+}
+
+// getPassphrase returns the passphrase, asking for it only once
+func (f *FileBackend) getPassphrase() ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.secret != nil {
+		return f.secret, nil
+	}
+	p, err := f.passphrase(!f.Exists())
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	f.secret = p
+	return p, nil
+}
+
+func (f *FileBackend) load() ([]entry, error) {
+	b, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading credential store: %w", err)
+	}
+
+	var ef encryptedFile
+	if err := json.Unmarshal(b, &ef); err != nil {
+		return nil, fmt.Errorf("parsing credential store: %w", err)
+	}
+	if ef.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported credential store version %d", ef.Version)
+	}
+	if err := checkScryptParams(ef.N, ef.R, ef.P); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongPassphrase, err)
+	}
+
+	passphrase, err := f.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, ef.Salt, ef.N, ef.R, ef.P, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, ef.Nonce, ef.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var entries []entry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("parsing credential store: %w", err)
+	}
+	return entries, nil
+}
+
+func (f *FileBackend) save(entries []entry) error {
+	passphrase, err := f.getPassphrase()
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	ef := encryptedFile{
+		Version: fileVersion,
+		Salt:    make([]byte, saltLen),
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+	}
+	if _, err := io.ReadFull(rand.Reader, ef.Salt); err != nil {
+		return err
+	}
+	key, err := scrypt.Key(passphrase, ef.Salt, ef.N, ef.R, ef.P, keyLen)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	ef.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, ef.Nonce); err != nil {
+		return err
+	}
+	ef.Ciphertext = gcm.Seal(nil, ef.Nonce, plaintext, nil)
+
+	b, err := json.Marshal(ef)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return fmt.Errorf("creating credential store directory: %w", err)
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("writing credential store: %w", err)
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// checkScryptParams returns an error if the scrypt parameters are invalid,
+// or would take more memory or time than tcli ever uses
+func checkScryptParams(n, r, p int) error {
+	if n <= 1 || n&(n-1) != 0 || n > maxScryptN {
+		return fmt.Errorf("scrypt N must be a power of two between 2 and %d, not %d", maxScryptN, n)
+	}
+	if r <= 0 || p <= 0 || p > maxScryptP || r*p >= 1<<30 {
+		return fmt.Errorf("invalid scrypt parameters r=%d p=%d", r, p)
+	}
+	if r > maxScryptMemory/128/n {
+		return fmt.Errorf("scrypt parameters N=%d r=%d need more than %d bytes of memory", n, r, maxScryptMemory)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,186 @@
+package credstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixedPassphrase returns a passphrase function always returning p, and
+// recording whether it was asked for a new passphrase
+func fixedPassphrase(p string, create *bool) func(bool) ([]byte, error) {
+	return func(c bool) ([]byte, error) {
+		if create != nil {
+			*create = c
+		}
+		return []byte(p), nil
+	}
+}
+
+func TestFileBackendRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	var create bool
+	f := NewFileBackend(path, fixedPassphrase("secret", &create))
+
+	if _, err := f.Get("supervisor.local", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get from missing store: got %v, want ErrNotFound", err)
+	}
+	if err := f.Set("supervisor.local", "bob", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if !create {
+		t.Error("passphrase wasn't asked for as a new one when creating the store")
+	}
+	if err := f.Set("other.local", "alice", "pa55"); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("store file mode is %v, want 0600", mode)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "hunter2") || strings.Contains(string(raw), "pa55") {
+		t.Error("store file contains a password in clear text")
+	}
+
+	// A new backend has to decrypt the file with the passphrase
+	reopened := NewFileBackend(path, fixedPassphrase("secret", &create))
+	got, err := reopened.Get("supervisor.local", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hunter2" {
+		t.Errorf("Get returned %q, want %q", got, "hunter2")
+	}
+	if create {
+		t.Error("passphrase was asked for as a new one for an existing store")
+	}
+	keys, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Key{{Server: "other.local", Username: "alice"}, {Server: "supervisor.local", Username: "bob"}}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("List returned %v, want %v", keys, want)
+	}
+
+	if err := reopened.Delete("supervisor.local", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("supervisor.local", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := reopened.Delete("supervisor.local", "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of missing entry: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileBackendWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := NewFileBackend(path, fixedPassphrase("secret", nil)).Set("supervisor.local", "bob", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFileBackend(path, fixedPassphrase("Secret", nil))
+	if _, err := f.Get("supervisor.local", "bob"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Get with wrong passphrase: got %v, want ErrWrongPassphrase", err)
+	}
+	// The store must not be overwritten with the wrong passphrase
+	if err := f.Set("supervisor.local", "bob", "other"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Set with wrong passphrase: got %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestFileBackendTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(ef *encryptedFile)
+	}{
+		{"ciphertext", func(ef *encryptedFile) { ef.Ciphertext[0] ^= 1 }},
+		{"nonce", func(ef *encryptedFile) { ef.Nonce[0] ^= 1 }},
+		{"salt", func(ef *encryptedFile) { ef.Salt[0] ^= 1 }},
+		{"scrypt cost", func(ef *encryptedFile) { ef.N = 1 << 14 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FileName)
+			if err := NewFileBackend(path, fixedPassphrase("secret", nil)).Set("supervisor.local", "bob", "hunter2"); err != nil {
+				t.Fatal(err)
+			}
+			modifyStore(t, path, tt.tamper)
+
+			f := NewFileBackend(path, fixedPassphrase("secret", nil))
+			if _, err := f.Get("supervisor.local", "bob"); !errors.Is(err, ErrWrongPassphrase) {
+				t.Errorf("Get from tampered store: got %v, want ErrWrongPassphrase", err)
+			}
+		})
+	}
+}
+
+func TestFileBackendScryptLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		n, r, p int
+	}{
+		{"huge N", 1 << 30, scryptR, scryptP},
+		{"N not a power of two", 3 << 14, scryptR, scryptP},
+		{"N too small", 1, scryptR, scryptP},
+		{"huge r", scryptN, 1 << 28, scryptP},
+		{"huge p", scryptN, scryptR, 1 << 28},
+		{"zero r", scryptN, 0, scryptP},
+		{"negative p", scryptN, scryptR, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), FileName)
+			if err := NewFileBackend(path, fixedPassphrase("secret", nil)).Set("supervisor.local", "bob", "hunter2"); err != nil {
+				t.Fatal(err)
+			}
+			modifyStore(t, path, func(ef *encryptedFile) {
+				ef.N, ef.R, ef.P = tt.n, tt.r, tt.p
+			})
+
+			f := NewFileBackend(path, fixedPassphrase("secret", nil))
+			if _, err := f.Get("supervisor.local", "bob"); !errors.Is(err, ErrWrongPassphrase) {
+				t.Errorf("Get with N=%d r=%d p=%d: got %v, want ErrWrongPassphrase", tt.n, tt.r, tt.p, err)
+			}
+		})
+	}
+}
+
+func TestFileBackendEmptyPassphrase(t *testing.T) {
+	f := NewFileBackend(filepath.Join(t.TempDir(), FileName), fixedPassphrase("", nil))
+	if err := f.Set("supervisor.local", "bob", "hunter2"); err == nil {
+		t.Error("Set with an empty passphrase succeeded")
+	}
+}
+
+func modifyStore(t *testing.T, path string, fn func(ef *encryptedFile)) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ef encryptedFile
+	if err := json.Unmarshal(raw, &ef); err != nil {
+		t.Fatal(err)
+	}
+	fn(&ef)
+	raw, err = json.Marshal(ef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,227 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultBackups is the number of backups kept by default
+const DefaultBackups = 10
+
+// manifestFile is the name of the file describing a backup
+const manifestFile = "manifest.json"
+
+// ErrBackupNotFound is returned when restoring a backup that doesn't exist
+var ErrBackupNotFound = errors.New("backup not found")
+
+// WithBackups makes the store back up kubeconfig files to dir before they
+// are changed, keeping the keep most recent backups. Backups are disabled if
+// keep is 0.
+func WithBackups(dir string, keep int) Option {
+	return func(s *Store) {
+		s.backupDir = dir
+		s.keepBackups = keep
+	}
+}
+
+// Backup is a copy of the kubeconfig files taken before they were changed
+type Backup struct {
+	// ID identifies the backup, and sorts in the order backups were taken
+	ID      string       `json:"-"`
+	Created time.Time    `json:"created"`
+	Files   []BackupFile `json:"files"`
+}
+
+// BackupFile is a kubeconfig file in a backup
+type BackupFile struct {
+	// Path is where the file was backed up from
+	Path string `json:"path"`
+	// Name is the name of the copy in the backup directory
+	Name string `json:"name"`
+}
+
+// Backups returns the backups, most recent first
+func (s *Store) Backups() ([]Backup, error) {
+	if len(s.backupDir) == 0 {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.backupDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := s.readBackup(e.Name())
+		if err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID > backups[j].ID
+	})
+	return backups, nil
+}
+
+func (s *Store) readBackup(id string) (Backup, error) {
+	var b Backup
+	raw, err := os.ReadFile(filepath.Join(s.backupDir, id, manifestFile))
+	if err != nil {
+		return b, err
+	}
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return b, err
+	}
+	b.ID = id
+	return b, nil
+}
+
+// Restore replaces the kubeconfig files with the copies in the backup id, or
+// in the most recent backup if id is empty. The files are backed up first,
+// so that a restore can be undone by restoring again.
+func (s *Store) Restore(id string) (Backup, error) {
+	if len(id) == 0 {
+		backups, err := s.Backups()
+		if err != nil {
+			return Backup{}, err
+		}
+		if len(backups) == 0 {
+			return Backup{}, ErrBackupNotFound
+		}
+		id = backups[0].ID
+	}
+	b, err := s.readBackup(filepath.Base(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Backup{}, fmt.Errorf("%w: %s", ErrBackupNotFound, id)
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("reading backup %s: %w", id, err)
+	}
+
+	paths := make([]string, 0, len(b.Files))
+	for _, f := range b.Files {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		unlock, err := lock(path)
+		if err != nil {
+			return Backup{}, err
+		}
+		defer unlock()
+	}
+
+	// Read the backup before taking a new one, which may rotate it away
+	data := make([][]byte, len(b.Files))
+	for i, f := range b.Files {
+		data[i], err = os.ReadFile(filepath.Join(s.backupDir, b.ID, f.Name))
+		if err != nil {
+			return Backup{}, err
+		}
+	}
+	if err := s.backup(paths); err != nil {
+		return Backup{}, fmt.Errorf("backing up kubeconfig: %w", err)
+	}
+	for i, f := range b.Files {
+		if err := writeFile(data[i], f.Path); err != nil {
+			return Backup{}, fmt.Errorf("writing %s: %w", f.Path, err)
+		}
+	}
+	return b, nil
+}
+
+// backup copies the existing files among paths to a new backup, and removes
+// the oldest backups beyond the number to keep. It must be called with the
+// files locked.
+func (s *Store) backup(paths []string) error {
+	if len(s.backupDir) == 0 || s.keepBackups <= 0 {
+		return nil
+	}
+
+	var b Backup
+	var data [][]byte
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		b.Files = append(b.Files, BackupFile{Path: abs, Name: strconv.Itoa(len(b.Files)) + ".yaml"})
+		data = append(data, raw)
+	}
+	if len(b.Files) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.backupDir, 0o700); err != nil {
+		return err
+	}
+	b.Created = time.Now()
+	dir, err := s.newBackupDir(b.Created)
+	if err != nil {
+		return err
+	}
+	for i, f := range b.Files {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), data[i], 0o600); err != nil {
+			return err
+		}
+	}
+	manifest, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestFile), manifest, 0o600); err != nil {
+		return err
+	}
+	return s.rotate()
+}
+
+// newBackupDir creates the directory of a backup taken at t. Its name is the
+// ID of the backup, which is made unique if another process took a backup at
+// the same time.
+func (s *Store) newBackupDir(t time.Time) (string, error) {
+	id := t.UTC().Format("20060102T150405.000Z")
+	for i := 2; ; i++ {
+		dir := filepath.Join(s.backupDir, id)
+		err := os.Mkdir(dir, 0o700)
+		if err == nil {
+			return dir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		id = t.UTC().Format("20060102T150405.000Z") + "-" + strconv.Itoa(i)
+	}
+}
+
+// rotate removes the oldest backups beyond the number to keep
+func (s *Store) rotate() error {
+	backups, err := s.Backups()
+	if err != nil {
+		return err
+	}
+	for i := s.keepBackups; i < len(backups); i++ {
+		if err := os.RemoveAll(filepath.Join(s.backupDir, backups[i].ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package kubeconfig_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/middlewaregruppen/tcli/pkg/kubeconfig"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	writeConfig(t, path, "a")
+	s := kubeconfig.NewStore(&clientcmd.ClientConfigLoadingRules{Precedence: []string{path}}, kubeconfig.WithBackups(filepath.Join(dir, "backups"), 2))
+
+	if _, err := s.Restore(""); !errors.Is(err, kubeconfig.ErrBackupNotFound) {
+		t.Errorf("got %v without backups, want ErrBackupNotFound", err)
+	}
+
+	// Each save backs up the file as it was before
+	for _, name := range []string{"b", "c", "d"} {
+		conf, err := s.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addContext(conf, name)
+		if err := s.Save(conf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := s.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("%d backups kept, want 2", len(backups))
+	}
+	if backups[0].ID <= backups[1].ID {
+		t.Errorf("backups aren't most recent first: %s, %s", backups[0].ID, backups[1].ID)
+	}
+	if len(backups[0].Files) != 1 || backups[0].Files[0].Path != path {
+		t.Errorf("backup has files %v, want %s", backups[0].Files, path)
+	}
+
+	// The most recent backup is from before d was added
+	b, err := s.Restore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != backups[0].ID {
+		t.Errorf("restored %s, want the most recent backup %s", b.ID, backups[0].ID)
+	}
+	if got := loadFile(t, path).Contexts; len(got) != 3 || got["d"] != nil {
+		t.Errorf("restored kubeconfig has contexts %v, want a, b and c", got)
+	}
+
+	// Restoring backs up first, so it can be undone
+	backups, err = s.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore(backups[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadFile(t, path).Contexts["d"]; !ok {
+		t.Error("restoring the backup taken by restore didn't bring back d")
+	}
+
+	if _, err := s.Restore("missing"); !errors.Is(err, kubeconfig.ErrBackupNotFound) {
+		t.Errorf("got %v for a missing backup, want ErrBackupNotFound", err)
+	}
+}
+
+func TestBackupsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	writeConfig(t, path, "a")
+	s := kubeconfig.NewStore(&clientcmd.ClientConfigLoadingRules{Precedence: []string{path}}, kubeconfig.WithBackups(filepath.Join(dir, "backups"), 0))
+
+	conf, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addContext(conf, "b")
+	if err := s.Save(conf); err != nil {
+		t.Fatal(err)
+	}
+	if backups, err := s.Backups(); err != nil || len(backups) != 0 {
+		t.Errorf("got backups %v, %v with backups disabled", backups, err)
+	}
+}
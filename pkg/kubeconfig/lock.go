@@ -0,0 +1,36 @@
+//go:build !windows
+
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// lock takes an exclusive advisory lock on the kubeconfig at path, waiting
+// for other processes to release it. Nothing is locked if the directory of
+// path doesn't exist, since there is nothing to protect then.
+func lock(path string) (unlock func(), err error) {
+	name := lockPath(path)
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o600)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, statErr := os.Stat(filepath.Dir(name)); errors.Is(statErr, os.ErrNotExist) {
+			return func() {}, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("locking kubeconfig: %w", err)
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking kubeconfig: %w", err)
+	}
+	return func() {
+		_ = unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,307 @@
+// Package kubeconfig implements a store for kubeconfig files that can be
+// updated by several processes at once without losing each other's changes.
+package kubeconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Store loads and saves the kubeconfig files found by a set of loading rules.
+// Save only writes the entries that were changed since Load, after locking
+// the files and reloading them, so that entries written by other processes
+// in the meantime are kept.
+type Store struct {
+	rules       *clientcmd.ClientConfigLoadingRules
+	backupDir   string
+	keepBackups int
+
+	mu     sync.Mutex
+	loaded map[*api.Config]*api.Config
+}
+
+// Option configures a Store
+type Option func(*Store)
+
+// NewStore returns a store for the kubeconfig files of rules
+func NewStore(rules *clientcmd.ClientConfigLoadingRules, opts ...Option) *Store {
+	s := &Store{rules: rules, loaded: map[*api.Config]*api.Config{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Path returns the file that new entries are written to
+func (s *Store) Path() string {
+	return s.rules.GetDefaultFilename()
+}
+
+// Create creates an empty kubeconfig at Path if it doesn't exist
+func (s *Store) Create() error {
+	path := s.Path()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return WriteFile(api.NewConfig(), path)
+}
+
+// Load returns the merged kubeconfig, and remembers it so that Save can tell
+// what has changed
+func (s *Store) Load() (*api.Config, error) {
+	conf, err := s.rules.Load()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.loaded[conf] = conf.DeepCopy()
+	s.mu.Unlock()
+	return conf, nil
+}
+
+// Save writes the clusters, authinfos and contexts that were added, changed
+// or removed in conf since it was returned by Load, as well as the current
+// context. Changed entries are written to the file that contains them, new
+// entries to Path. The files are backed up before they are changed if the
+// store was created WithBackups. conf doesn't have to come from Load, in which case all of
+// its entries are written and none are removed.
+func (s *Store) Save(conf *api.Config) error {
+	s.mu.Lock()
+	base, ok := s.loaded[conf]
+	s.mu.Unlock()
+	if !ok {
+		base = api.NewConfig()
+	}
+
+	// Lock in a fixed order so that two processes can't deadlock
+	paths := append([]string(nil), s.rules.GetLoadingPrecedence()...)
+	sort.Strings(paths)
+	for _, path := range paths {
+		unlock, err := lock(path)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	current, err := s.rules.Load()
+	if err != nil {
+		return err
+	}
+	files := map[string]*api.Config{}
+	file := func(path string) (*api.Config, error) {
+		if f, ok := files[path]; ok {
+			return f, nil
+		}
+		f, err := clientcmd.LoadFromFile(path)
+		if os.IsNotExist(err) {
+			f, err = api.NewConfig(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[path] = f
+		return f, nil
+	}
+	destination := func(origins ...string) string {
+		for _, o := range origins {
+			if len(o) > 0 {
+				return o
+			}
+		}
+		return s.Path()
+	}
+
+	for name, cluster := range conf.Clusters {
+		if old, ok := base.Clusters[name]; ok && reflect.DeepEqual(old, cluster) {
+			continue
+		}
+		var origin string
+		if c, ok := current.Clusters[name]; ok {
+			origin = c.LocationOfOrigin
+		}
+		f, err := file(destination(origin, cluster.LocationOfOrigin))
+		if err != nil {
+			return err
+		}
+		f.Clusters[name] = cluster
+	}
+	for name, authInfo := range conf.AuthInfos {
+		if old, ok := base.AuthInfos[name]; ok && reflect.DeepEqual(old, authInfo) {
+			continue
+		}
+		var origin string
+		if a, ok := current.AuthInfos[name]; ok {
+			origin = a.LocationOfOrigin
+		}
+		f, err := file(destination(origin, authInfo.LocationOfOrigin))
+		if err != nil {
+			return err
+		}
+		f.AuthInfos[name] = authInfo
+	}
+	for name, ctx := range conf.Contexts {
+		if old, ok := base.Contexts[name]; ok && reflect.DeepEqual(old, ctx) {
+			continue
+		}
+		var origin string
+		if c, ok := current.Contexts[name]; ok {
+			origin = c.LocationOfOrigin
+		}
+		f, err := file(destination(origin, ctx.LocationOfOrigin))
+		if err != nil {
+			return err
+		}
+		f.Contexts[name] = ctx
+	}
+
+	// Entries that were removed are deleted from the file holding them, if
+	// another process hasn't already done so
+	for name := range base.Clusters {
+		if c, ok := current.Clusters[name]; ok && conf.Clusters[name] == nil {
+			f, err := file(c.LocationOfOrigin)
+			if err != nil {
+				return err
+			}
+			delete(f.Clusters, name)
+		}
+	}
+	for name := range base.AuthInfos {
+		if a, ok := current.AuthInfos[name]; ok && conf.AuthInfos[name] == nil {
+			f, err := file(a.LocationOfOrigin)
+			if err != nil {
+				return err
+			}
+			delete(f.AuthInfos, name)
+		}
+	}
+	for name := range base.Contexts {
+		if c, ok := current.Contexts[name]; ok && conf.Contexts[name] == nil {
+			f, err := file(c.LocationOfOrigin)
+			if err != nil {
+				return err
+			}
+			delete(f.Contexts, name)
+		}
+	}
+
+	// Like kubectl, a new current context is written to Path, while a
+	// cleared one is cleared in the first file setting it
+	if conf.CurrentContext != base.CurrentContext && conf.CurrentContext != current.CurrentContext {
+		if len(conf.CurrentContext) > 0 {
+			f, err := file(s.Path())
+			if err != nil {
+				return err
+			}
+			f.CurrentContext = conf.CurrentContext
+		} else {
+			for _, path := range s.rules.GetLoadingPrecedence() {
+				if _, err := os.Stat(path); err != nil {
+					continue
+				}
+				f, err := file(path)
+				if err != nil {
+					return err
+				}
+				if len(f.CurrentContext) > 0 {
+					f.CurrentContext = ""
+					break
+				}
+			}
+		}
+	}
+
+	changed := make([]string, 0, len(files))
+	for path := range files {
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+	if err := s.backup(changed); err != nil {
+		return fmt.Errorf("backing up kubeconfig: %w", err)
+	}
+	for path, f := range files {
+		if err := WriteFile(f, path); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.loaded[conf] = conf.DeepCopy()
+	s.mu.Unlock()
+	return nil
+}
+
+// WriteFile atomically replaces the kubeconfig file at path with conf, by
+// writing it to a temporary file that is renamed over path. The permissions
+// of an existing file are kept, new files are only readable by the user.
+// Symbolic links are followed, so that the file they point to is replaced.
+func WriteFile(conf *api.Config, path string) error {
+	b, err := clientcmd.Write(*conf)
+	if err != nil {
+		return err
+	}
+	return writeFile(b, path)
+}
+
+// writeFile atomically replaces the file at path with b, see WriteFile
+func writeFile(b []byte, path string) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+
+	mode := os.FileMode(0o600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockPath returns the file used to lock the kubeconfig at path. The
+// kubeconfig itself can't be locked since it is replaced when written, and
+// kubectl treats path + ".lock" as a lock by its mere existence.
+func lockPath(path string) string {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tcli-lock")
+}
@@ -0,0 +1,191 @@
+package kubeconfig_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/middlewaregruppen/tcli/pkg/kubeconfig"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// addContext adds a cluster, authinfo and context called name to conf
+func addContext(conf *api.Config, name string) {
+	conf.Clusters[name] = &api.Cluster{Server: "https://" + name + ".local"}
+	conf.AuthInfos[name] = &api.AuthInfo{Token: name + "-token"}
+	conf.Contexts[name] = &api.Context{Cluster: name, AuthInfo: name}
+}
+
+// writeConfig writes a kubeconfig with a context for each of names to path
+func writeConfig(t *testing.T, path string, names ...string) {
+	t.Helper()
+	conf := api.NewConfig()
+	for _, name := range names {
+		addContext(conf, name)
+	}
+	if err := kubeconfig.WriteFile(conf, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadFile(t *testing.T, path string) *api.Config {
+	t.Helper()
+	conf, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func newStore(paths ...string) *kubeconfig.Store {
+	return kubeconfig.NewStore(&clientcmd.ClientConfigLoadingRules{Precedence: paths})
+}
+
+func TestSaveMerges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeConfig(t, path, "old")
+
+	// Two processes load the kubeconfig before either has saved
+	s1, s2 := newStore(path), newStore(path)
+	conf1, err := s1.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf2, err := s2.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addContext(conf1, "first")
+	conf1.CurrentContext = "first"
+	if err := s1.Save(conf1); err != nil {
+		t.Fatal(err)
+	}
+	addContext(conf2, "second")
+	delete(conf2.Contexts, "old")
+	if err := s2.Save(conf2); err != nil {
+		t.Fatal(err)
+	}
+
+	got := loadFile(t, path)
+	for _, name := range []string{"first", "second"} {
+		if _, ok := got.Contexts[name]; !ok {
+			t.Errorf("context %q was lost", name)
+		}
+	}
+	if _, ok := got.Contexts["old"]; ok {
+		t.Error("removed context is still there")
+	}
+	if _, ok := got.Clusters["old"]; !ok {
+		t.Error("cluster that wasn't removed is gone")
+	}
+	if got.CurrentContext != "first" {
+		t.Errorf("current context is %q, want the one set by the first process", got.CurrentContext)
+	}
+}
+
+func TestSaveFileOfOrigin(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	writeConfig(t, first, "a")
+	writeConfig(t, second, "b")
+
+	s := newStore(first, second)
+	conf, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.AuthInfos["b"].Token = "renewed"
+	addContext(conf, "c")
+	if err := s.Save(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if token := loadFile(t, second).AuthInfos["b"].Token; token != "renewed" {
+		t.Errorf("token in the file it came from is %q, want renewed", token)
+	}
+	if _, ok := loadFile(t, first).AuthInfos["b"]; ok {
+		t.Error("changed entry was copied to the first file")
+	}
+	if _, ok := loadFile(t, first).Contexts["c"]; !ok {
+		t.Error("new context wasn't written to the first file")
+	}
+	if _, ok := loadFile(t, second).Contexts["c"]; ok {
+		t.Error("new context was written to the second file")
+	}
+}
+
+func TestSaveConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	writeConfig(t, path)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := newStore(path)
+			conf, err := s.Load()
+			if err != nil {
+				errs <- err
+				return
+			}
+			addContext(conf, fmt.Sprintf("ctx-%d", i))
+			errs <- s.Save(conf)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(loadFile(t, path).Contexts); got != n {
+		t.Errorf("kubeconfig has %d contexts, want %d", got, n)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	writeConfig(t, path, "a")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("new file has mode %v, want 0600", mode)
+	}
+
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(t, link, "b")
+
+	fi, err = os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("symbolic link was replaced by a file")
+	}
+	if _, ok := loadFile(t, path).Contexts["b"]; !ok {
+		t.Error("file the link points to wasn't written")
+	}
+	fi, err = os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o640 {
+		t.Errorf("existing file has mode %v, want 0640 to be kept", mode)
+	}
+}
@@ -0,0 +1,680 @@
+// Package supervisortest provides an in-process stand-in for the vSphere with
+// Tanzu supervisor. It serves the WCP endpoints used by tcli to authenticate
+// (/wcp/login and /wcp/workloads) as well as the run.tanzu.vmware.com APIs, so
+// that the login, list, inspect and logout flows can be exercised end-to-end
+// against a real HTTP server without access to a vSphere lab.
+package supervisortest
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/middlewaregruppen/tcli/pkg/client"
+	"github.com/vmware-tanzu/tanzu-framework/apis/run/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+const (
+	pathRunAPI       = "/apis/run.tanzu.vmware.com/v1alpha2/"
+	defaultRelease   = "v1.23.8---vmware.3-tkg.1"
+	defaultTokenLife = 10 * time.Hour
+	issuer           = "supervisortest"
+)
+
+// User is an account that may authenticate against the simulator
+type User struct {
+	Username string
+	Password string
+	// Namespaces the user has access to. An empty list grants access to
+	// every namespace known to the simulator.
+	Namespaces []string
+}
+
+// Cluster is a Tanzu Kubernetes cluster served by the simulator
+type Cluster struct {
+	Namespace string
+	Name      string
+	Labels    map[string]string
+	// Release is the TKR name of the cluster. Defaults to a v1.23 release.
+	Release      string
+	ControlPlane int32
+	Workers      int32
+	Created      time.Time
+}
+
+// Faults describes failures injected into every request served by the
+// simulator. The zero value injects no faults.
+type Faults struct {
+	// Latency is added before each request is handled
+	Latency time.Duration
+	// ErrorRate is the fraction (0-1) of requests answered with StatusCode
+	ErrorRate float64
+	// StatusCode returned for failed requests. Defaults to 503.
+	StatusCode int
+	// TLSError makes every TLS handshake fail
+	TLSError bool
+}
+
+// Server is a running supervisor simulator. Use [NewServer] to create one.
+type Server struct {
+	// URL is the base URL of the simulator, suitable for tcli's --server flag
+	URL string
+
+	srv         *httptest.Server
+	key         []byte
+	logger      *slog.Logger
+	listener    net.Listener
+	tokenExpiry time.Duration
+
+	mu         sync.Mutex
+	users      map[string]User
+	namespaces []string
+	clusters   []Cluster
+	faults     Faults
+	now        func() time.Time
+}
+
+type Option func(*Server)
+
+// WithUser adds a user that can log in with the given password. If no
+// namespaces are given the user has access to all namespaces.
+func WithUser(username, password string, namespaces ...string) Option {
+	return func(s *Server) {
+		s.users[username] = User{Username: username, Password: password, Namespaces: namespaces}
+		s.addNamespaces(namespaces...)
+	}
+}
+
+// WithNamespaces adds vSphere namespaces to the simulator
+func WithNamespaces(namespaces ...string) Option {
+	return func(s *Server) {
+		s.addNamespaces(namespaces...)
+	}
+}
+
+// WithCluster adds a Tanzu Kubernetes cluster. The cluster namespace is
+// created if it doesn't exist.
+func WithCluster(c Cluster) Option {
+	return func(s *Server) {
+		s.clusters = append(s.clusters, withDefaults(c))
+		s.addNamespaces(c.Namespace)
+	}
+}
+
+// WithTokenExpiry sets the lifetime of issued session tokens. Defaults to 10
+// hours, same as a real supervisor.
+func WithTokenExpiry(d time.Duration) Option {
+	return func(s *Server) {
+		s.tokenExpiry = d
+	}
+}
+
+// WithFaults injects faults into every request
+func WithFaults(f Faults) Option {
+	return func(s *Server) {
+		s.faults = f
+	}
+}
+
+// WithListener makes the simulator serve on l instead of a random loopback port
+func WithListener(l net.Listener) Option {
+	return func(s *Server) {
+		s.listener = l
+	}
+}
+
+// WithLogger makes the simulator log every request it serves to l
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithClock overrides the time source used when issuing and validating tokens
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// NewServer starts a TLS enabled supervisor simulator configured by opts. The
+// caller should call Close when finished, to shut it down.
+func NewServer(opts ...Option) *Server {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("supervisortest: generating signing key: %v", err))
+	}
+
+	s := &Server{
+		key:         key,
+		logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		tokenExpiry: defaultTokenLife,
+		users:       map[string]User{},
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.srv = httptest.NewUnstartedServer(s)
+	if s.listener != nil {
+		_ = s.srv.Listener.Close()
+		s.srv.Listener = s.listener
+	}
+	s.srv.TLS = &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			if s.Faults().TLSError {
+				return nil, fmt.Errorf("supervisortest: injected TLS handshake failure")
+			}
+			return nil, nil
+		},
+	}
+	s.srv.StartTLS()
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the simulator and blocks until all outstanding requests
+// have completed
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Certificate returns the certificate used by the simulator
+func (s *Server) Certificate() *x509.Certificate {
+	return s.srv.Certificate()
+}
+
+// CertificatePEM returns the PEM encoded certificate used by the simulator.
+// It can be used as a CA bundle to verify connections to it.
+func (s *Server) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.srv.Certificate().Raw})
+}
+
+// HTTPClient returns an http client which trusts the simulator certificate
+func (s *Server) HTTPClient() *http.Client {
+	return s.srv.Client()
+}
+
+// Host returns the host:port the simulator is listening on
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// Faults returns the faults currently injected by the simulator
+func (s *Server) Faults() Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults
+}
+
+// SetFaults replaces the faults injected by the simulator
+func (s *Server) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+}
+
+// AddCluster adds a cluster to a running simulator
+func (s *Server) AddCluster(c Cluster) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters = append(s.clusters, withDefaults(c))
+	s.addNamespaces(c.Namespace)
+}
+
+// DeleteCluster removes a cluster from a running simulator. It reports
+// whether the cluster existed.
+func (s *Server) DeleteCluster(namespace, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.clusters {
+		if c.Namespace == namespace && c.Name == name {
+			s.clusters = append(s.clusters[:i], s.clusters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// IssueToken returns a session token for username that expires after d. A
+// negative d produces a token that has already expired.
+func (s *Server) IssueToken(username string, d time.Duration) string {
+	return s.issue(username, "", d)
+}
+
+func (s *Server) issue(subject, audience string, d time.Duration) string {
+	now := s.now()
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(fmt.Sprintf("supervisortest: generating token ID: %v", err))
+	}
+	token, err := sign(s.key, claims{
+		ID:        hex.EncodeToString(id),
+		Subject:   subject,
+		Issuer:    issuer,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(d).Unix(),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("supervisortest: signing token: %v", err))
+	}
+	return token
+}
+
+func (s *Server) addNamespaces(namespaces ...string) {
+	for _, ns := range namespaces {
+		if !contains(s.namespaces, ns) {
+			s.namespaces = append(s.namespaces, ns)
+		}
+	}
+	sort.Strings(s.namespaces)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.logger.Debug("supervisortest request", "method", r.Method, "path", r.URL.Path)
+
+	f := s.Faults()
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if f.ErrorRate > 0 && mathrand.Float64() < f.ErrorRate {
+		code := f.StatusCode
+		if code == 0 {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, "supervisortest: injected failure", code)
+		return
+	}
+
+	switch {
+	case r.URL.Path == client.PathWCPLogin:
+		s.handleLogin(w, r)
+	case r.URL.Path == client.PathWCPWorkloads:
+		s.handleWorkloads(w, r)
+	case strings.HasPrefix(r.URL.Path, pathRunAPI):
+		s.handleRunAPI(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	username, password, ok := r.BasicAuth()
+	s.mu.Lock()
+	user, found := s.users[username]
+	s.mu.Unlock()
+	if !ok || !found || user.Password != password {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		GuestClusterName      string `json:"guest_cluster_name"`
+		GuestClusterNamespace string `json:"guest_cluster_namespace"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(body.GuestClusterName) == 0 {
+		writeJSON(w, client.LoginResponse{SessionID: s.issue(username, "", s.tokenExpiry)})
+		return
+	}
+
+	c, ok := s.findCluster(user, body.GuestClusterNamespace, body.GuestClusterName)
+	if !ok {
+		// The supervisor answers logins to unknown clusters without a guest
+		// cluster server, which the client reports as ErrClusterNotFound.
+		writeJSON(w, client.LoginResponse{})
+		return
+	}
+	server := guestServer(c)
+	writeJSON(w, client.LoginClusterResponse{
+		LoginResponse:      client.LoginResponse{SessionID: s.issue(username, server, s.tokenExpiry)},
+		GuestClusterServer: server,
+		GuestClusterCa:     base64.StdEncoding.EncodeToString(s.CertificatePEM()),
+	})
+}
+
+func (s *Server) handleWorkloads(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.authenticateBasic(w, r)
+	if !ok {
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	namespaces := []client.Namespace{}
+	for _, ns := range s.userNamespaces(user) {
+		namespaces = append(namespaces, client.Namespace{
+			Namespace:                ns,
+			MasterHost:               host,
+			ConrolPlaneAPIServerPort: "6443",
+			ControlPlaneDNSNames:     []string{host},
+		})
+	}
+	writeJSON(w, namespaces)
+}
+
+func (s *Server) handleRunAPI(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.authenticateToken(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	asTable := strings.Contains(r.Header.Get("Accept"), "as=Table")
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, pathRunAPI), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "tanzukubernetesreleases":
+		s.serveReleases(w, asTable)
+	case len(parts) == 1 && parts[0] == "tanzukubernetesaddons":
+		s.serveAddons(w, asTable)
+	case len(parts) == 3 && parts[0] == "namespaces" && parts[2] == "tanzukubernetesclusters":
+		if !contains(s.userNamespaces(user), parts[1]) {
+			http.Error(w, fmt.Sprintf("namespace %q is forbidden for user %q", parts[1], user.Username), http.StatusForbidden)
+			return
+		}
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid label selector: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.serveClusters(w, s.clustersIn(parts[1], selector), asTable)
+	case len(parts) == 4 && parts[0] == "namespaces" && parts[2] == "tanzukubernetesclusters":
+		c, ok := s.findCluster(user, parts[1], parts[3])
+		if !ok {
+			http.Error(w, fmt.Sprintf("tanzukubernetesclusters %q not found", parts[3]), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, tkc(c))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authenticateBasic validates the basic credentials of r, which the WCP API
+// of the supervisor takes, and returns the user making the request. An error
+// response is written if the request isn't authenticated.
+func (s *Server) authenticateBasic(w http.ResponseWriter, r *http.Request) (User, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		http.Error(w, "basic credentials required", http.StatusUnauthorized)
+		return User{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, found := s.users[username]
+	if !found || user.Password != password {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return User{}, false
+	}
+	return user, true
+}
+
+// authenticateToken validates the session token of r, which the Kubernetes
+// API of the supervisor takes, and returns the user making the request. An
+// error response is written if the request isn't authenticated.
+func (s *Server) authenticateToken(w http.ResponseWriter, r *http.Request) (User, bool) {
+	if _, _, ok := r.BasicAuth(); ok {
+		http.Error(w, "basic authentication is not supported, use a session token", http.StatusUnauthorized)
+		return User{}, false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	c, err := verify(s.key, token, s.now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return User{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[c.Subject]
+	if !ok {
+		http.Error(w, "unknown user", http.StatusUnauthorized)
+		return User{}, false
+	}
+	return user, true
+}
+
+func (s *Server) userNamespaces(u User) []string {
+	if len(u.Namespaces) > 0 {
+		return u.Namespaces
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.namespaces...)
+}
+
+func (s *Server) clustersIn(namespace string, selector labels.Selector) []Cluster {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []Cluster
+	for _, c := range s.clusters {
+		if c.Namespace == namespace && selector.Matches(labels.Set(c.Labels)) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// findCluster looks up a cluster by name among the namespaces available to
+// u. If namespace is empty the first cluster with a matching name is returned.
+func (s *Server) findCluster(u User, namespace, name string) (Cluster, bool) {
+	allowed := s.userNamespaces(u)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clusters {
+		if c.Name != name || !contains(allowed, c.Namespace) {
+			continue
+		}
+		if len(namespace) == 0 || c.Namespace == namespace {
+			return c, true
+		}
+	}
+	return Cluster{}, false
+}
+
+func (s *Server) serveClusters(w http.ResponseWriter, clusters []Cluster, asTable bool) {
+	if !asTable {
+		list := v1alpha2.TanzuKubernetesClusterList{
+			TypeMeta: v1.TypeMeta{APIVersion: v1alpha2.GroupVersion.String(), Kind: "TanzuKubernetesClusterList"},
+			Items:    []v1alpha2.TanzuKubernetesCluster{},
+		}
+		for _, c := range clusters {
+			list.Items = append(list.Items, *tkc(c))
+		}
+		writeJSON(w, list)
+		return
+	}
+
+	table := newTable("NAME", "CONTROL PLANE", "WORKER", "TKR NAME", "AGE", "READY")
+	for _, c := range clusters {
+		c = withDefaults(c)
+		table.Rows = append(table.Rows, v1.TableRow{
+			Cells:  []interface{}{c.Name, c.ControlPlane, c.Workers, c.Release, age(c.Created), "True"},
+			Object: rawObject(tkc(c)),
+		})
+	}
+	writeJSON(w, table)
+}
+
+func (s *Server) serveReleases(w http.ResponseWriter, asTable bool) {
+	s.mu.Lock()
+	releases := []string{defaultRelease}
+	for _, c := range s.clusters {
+		if len(c.Release) > 0 && !contains(releases, c.Release) {
+			releases = append(releases, c.Release)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(releases)
+
+	if !asTable {
+		list := v1alpha2.TanzuKubernetesReleaseList{
+			TypeMeta: v1.TypeMeta{APIVersion: v1alpha2.GroupVersion.String(), Kind: "TanzuKubernetesReleaseList"},
+		}
+		for _, rel := range releases {
+			list.Items = append(list.Items, v1alpha2.TanzuKubernetesRelease{
+				TypeMeta:   v1.TypeMeta{APIVersion: v1alpha2.GroupVersion.String(), Kind: "TanzuKubernetesRelease"},
+				ObjectMeta: v1.ObjectMeta{Name: rel},
+				Spec:       v1alpha2.TanzuKubernetesReleaseSpec{Version: releaseVersion(rel)},
+			})
+		}
+		writeJSON(w, list)
+		return
+	}
+
+	table := newTable("NAME", "VERSION", "READY", "COMPATIBLE")
+	for _, rel := range releases {
+		table.Rows = append(table.Rows, v1.TableRow{Cells: []interface{}{rel, releaseVersion(rel), "True", "True"}})
+	}
+	writeJSON(w, table)
+}
+
+func (s *Server) serveAddons(w http.ResponseWriter, asTable bool) {
+	addons := [][]interface{}{
+		{"antrea", "antrea", "1.5.3+vmware.3-tkg.1"},
+		{"calico", "calico", "3.22.1+vmware.1-tkg.1"},
+		{"pvcsi", "pvcsi", "2.5.1"},
+	}
+	if !asTable {
+		writeJSON(w, v1.List{TypeMeta: v1.TypeMeta{APIVersion: "v1", Kind: "List"}})
+		return
+	}
+	table := newTable("NAME", "TYPE", "VERSION")
+	for _, a := range addons {
+		table.Rows = append(table.Rows, v1.TableRow{Cells: a})
+	}
+	writeJSON(w, table)
+}
+
+func tkc(c Cluster) *v1alpha2.TanzuKubernetesCluster {
+	c = withDefaults(c)
+	return &v1alpha2.TanzuKubernetesCluster{
+		TypeMeta: v1.TypeMeta{APIVersion: v1alpha2.GroupVersion.String(), Kind: "TanzuKubernetesCluster"},
+		ObjectMeta: v1.ObjectMeta{
+			Name:              c.Name,
+			Namespace:         c.Namespace,
+			Labels:            c.Labels,
+			CreationTimestamp: v1.NewTime(c.Created),
+		},
+		Spec: v1alpha2.TanzuKubernetesClusterSpec{
+			Topology: v1alpha2.Topology{
+				ControlPlane: v1alpha2.TopologySettings{
+					Replicas: &c.ControlPlane,
+					VMClass:  "best-effort-small",
+					TKR:      v1alpha2.TKRReference{Reference: &corev1.ObjectReference{Name: c.Release}},
+				},
+				NodePools: []v1alpha2.NodePool{{
+					Name: "workers",
+					TopologySettings: v1alpha2.TopologySettings{
+						Replicas: &c.Workers,
+						VMClass:  "best-effort-small",
+						TKR:      v1alpha2.TKRReference{Reference: &corev1.ObjectReference{Name: c.Release}},
+					},
+				}},
+			},
+		},
+		Status: v1alpha2.TanzuKubernetesClusterStatus{
+			APIEndpoints:        []v1alpha2.APIEndpoint{{Host: guestServer(c), Port: 6443}},
+			Version:             releaseVersion(c.Release),
+			Phase:               "running",
+			TotalWorkerReplicas: c.Workers,
+		},
+	}
+}
+
+func withDefaults(c Cluster) Cluster {
+	if len(c.Release) == 0 {
+		c.Release = defaultRelease
+	}
+	if c.ControlPlane == 0 {
+		c.ControlPlane = 1
+	}
+	if c.Created.IsZero() {
+		c.Created = time.Now()
+	}
+	return c
+}
+
+// guestServer returns the API server address of a guest cluster
+func guestServer(c Cluster) string {
+	return fmt.Sprintf("%s.%s.tkg.local", c.Name, c.Namespace)
+}
+
+// releaseVersion converts a TKR name such as v1.23.8---vmware.3-tkg.1 to its
+// semantic version v1.23.8+vmware.3-tkg.1
+func releaseVersion(rel string) string {
+	return strings.Replace(rel, "---", "+", 1)
+}
+
+func age(t time.Time) string {
+	return duration.HumanDuration(time.Since(t))
+}
+
+func newTable(columns ...string) *v1.Table {
+	t := &v1.Table{TypeMeta: v1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "Table"}}
+	for _, c := range columns {
+		t.ColumnDefinitions = append(t.ColumnDefinitions, v1.TableColumnDefinition{Name: c, Type: "string"})
+	}
+	return t
+}
+
+func rawObject(obj interface{}) runtime.RawExtension {
+	b, _ := json.Marshal(obj)
+	return runtime.RawExtension{Raw: b}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package supervisortest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	errMalformedToken = errors.New("malformed token")
+	errInvalidToken   = errors.New("invalid token signature")
+	errExpiredToken   = errors.New("token has expired")
+)
+
+// claims is the payload of the JWT session tokens issued by the simulator. It
+// carries the same registered claims as the tokens issued by a real supervisor.
+type claims struct {
+	ID        string `json:"jti"`
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// sign encodes c as an HS256 signed JWT using key
+func sign(key []byte, c claims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify checks the signature and expiry of token and returns its claims
+func verify(key []byte, token string, now time.Time) (*claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, errMalformedToken
+	}
+	if now.Unix() >= c.ExpiresAt {
+		return nil, errExpiredToken
+	}
+	return &c, nil
+}
@@ -0,0 +1,230 @@
+// Package trust implements trust-on-first-use pinning of supervisor
+// certificates. The first time tcli connects to a supervisor whose
+// certificate chain can't be verified, the user is asked whether to trust
+// the certificate. Trusted certificates are pinned in a known hosts file, and
+// later connections must present the pinned certificate.
+package trust
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUntrusted is returned when the certificate chain of a host can't be
+	// verified and the user didn't trust it
+	ErrUntrusted = errors.New("certificate is not trusted")
+	// ErrMismatch is returned when a host presents a certificate other than
+	// the one pinned for it
+	ErrMismatch = errors.New("certificate does not match the pinned certificate")
+)
+
+// Pin is a trusted certificate of a host
+type Pin struct {
+	// Host is the host:port of the server
+	Host string
+	// Fingerprint is the SHA-256 fingerprint of the leaf certificate
+	Fingerprint string
+	// CA is the DER encoded topmost certificate of the chain presented by the
+	// host. For self-signed certificates it is the leaf certificate itself.
+	CA []byte
+}
+
+// Prompt asks the user whether to trust the certificate chain presented by
+// host, whose chain couldn't be verified because of verifyErr
+type Prompt func(host string, chain []*x509.Certificate, verifyErr error) (bool, error)
+
+// Store is a known hosts file of pinned certificates
+type Store struct {
+	path string
+	mu   sync.Mutex
+	pins map[string]Pin
+
+	// promptMu serializes prompts, so that concurrent connections to the
+	// same host only ask once
+	promptMu sync.Mutex
+	declined map[string]bool
+}
+
+// Load reads the known hosts file at path. A missing file is treated as an
+// empty store and is created when the first pin is added.
+func Load(path string) (*Store, error) {
+	s := &Store{path: path, pins: map[string]Pin{}, declined: map[string]bool{}}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected HOST FINGERPRINT [CA]", path, line)
+		}
+		p := Pin{Host: fields[0], Fingerprint: fields[1]}
+		if len(fields) > 2 {
+			if p.CA, err = base64.StdEncoding.DecodeString(fields[2]); err != nil {
+				return nil, fmt.Errorf("%s:%d: decoding CA: %w", path, line, err)
+			}
+		}
+		s.pins[p.Host] = p
+	}
+	return s, scanner.Err()
+}
+
+// Path returns the location of the known hosts file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the pin of host
+func (s *Store) Get(host string) (Pin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pins[host]
+	return p, ok
+}
+
+// Add pins a certificate, replacing any existing pin of the host, and saves
+// the store
+func (s *Store) Add(p Pin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pins[p.Host] = p
+	return s.save()
+}
+
+// Remove deletes the pin of host and saves the store
+func (s *Store) Remove(host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pins, host)
+	return s.save()
+}
+
+func (s *Store) save() error {
+	hosts := make([]string, 0, len(s.pins))
+	for h := range s.pins {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	var b strings.Builder
+	b.WriteString("# Supervisor certificates trusted by tcli. Remove a line to trust a new certificate.\n")
+	for _, h := range hosts {
+		p := s.pins[h]
+		fmt.Fprintf(&b, "%s %s %s\n", p.Host, p.Fingerprint, base64.StdEncoding.EncodeToString(p.CA))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of cert in the form
+// SHA256:AB:CD:...
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	hex := make([]string, len(sum))
+	for i, b := range sum {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return "SHA256:" + strings.Join(hex, ":")
+}
+
+// VerifyConnection returns a function for tls.Config.VerifyConnection which
+// verifies connections to host, given as host:port.
+//
+// If host has a pinned certificate the leaf certificate must match it.
+// Otherwise the chain is verified against roots, or the system roots if
+// roots is nil, using serverName if set. If that fails, prompt is asked
+// whether to trust the certificate, in which case it is pinned.
+func (s *Store) VerifyConnection(host, serverName string, roots *x509.CertPool, prompt Prompt) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificates")
+		}
+		leaf := cs.PeerCertificates[0]
+		fingerprint := Fingerprint(leaf)
+
+		if pin, ok := s.Get(host); ok {
+			if pin.Fingerprint != fingerprint {
+				return fmt.Errorf("%w: %s presented %s but %s is pinned in %s. "+
+					"This may be a man-in-the-middle attack, or the supervisor certificate has been replaced. "+
+					"If you are sure the new certificate is legitimate, remove the line for %s from %s",
+					ErrMismatch, host, fingerprint, pin.Fingerprint, s.path, host, s.path)
+			}
+			return nil
+		}
+
+		if len(serverName) == 0 {
+			serverName, _, _ = net.SplitHostPort(host)
+			if len(serverName) == 0 {
+				serverName = host
+			}
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, verifyErr := leaf.Verify(x509.VerifyOptions{
+			DNSName:       serverName,
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if verifyErr == nil {
+			return nil
+		}
+
+		if prompt == nil {
+			return fmt.Errorf("%w: %v", ErrUntrusted, verifyErr)
+		}
+
+		s.promptMu.Lock()
+		defer s.promptMu.Unlock()
+		if pin, ok := s.Get(host); ok && pin.Fingerprint == fingerprint {
+			return nil
+		}
+		if s.declined[fingerprint] {
+			return fmt.Errorf("%w: %v", ErrUntrusted, verifyErr)
+		}
+		trusted, err := prompt(host, cs.PeerCertificates, verifyErr)
+		if err != nil {
+			return err
+		}
+		if !trusted {
+			s.declined[fingerprint] = true
+			return fmt.Errorf("%w: %v", ErrUntrusted, verifyErr)
+		}
+		return s.Add(Pin{
+			Host:        host,
+			Fingerprint: fingerprint,
+			CA:          cs.PeerCertificates[len(cs.PeerCertificates)-1].Raw,
+		})
+	}
+}
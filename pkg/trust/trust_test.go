@@ -0,0 +1,162 @@
+package trust
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSigned returns a self-signed certificate for dnsName
+func selfSigned(t *testing.T, dnsName string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: dnsName},
+		DNSNames:              []string{dnsName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// prompter is a Prompt answering trusted, counting how often it was asked
+type prompter struct {
+	trusted bool
+	asked   int
+}
+
+func (p *prompter) prompt(host string, chain []*x509.Certificate, verifyErr error) (bool, error) {
+	p.asked++
+	return p.trusted, nil
+}
+
+func state(cert *x509.Certificate) tls.ConnectionState {
+	return tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+}
+
+func TestVerifyConnectionPinsOnFirstUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := selfSigned(t, "supervisor.local")
+	p := &prompter{trusted: true}
+	verify := s.VerifyConnection("supervisor.local:443", "", nil, p.prompt)
+
+	if err := verify(state(cert)); err != nil {
+		t.Fatalf("trusted certificate was rejected: %v", err)
+	}
+	if err := verify(state(cert)); err != nil {
+		t.Fatalf("pinned certificate was rejected: %v", err)
+	}
+	if p.asked != 1 {
+		t.Errorf("asked %d times, want 1", p.asked)
+	}
+
+	// The pin must survive reloading the store
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, ok := reloaded.Get("supervisor.local:443")
+	if !ok {
+		t.Fatal("certificate wasn't pinned")
+	}
+	if pin.Fingerprint != Fingerprint(cert) {
+		t.Errorf("pinned %s, want %s", pin.Fingerprint, Fingerprint(cert))
+	}
+	if err := reloaded.VerifyConnection("supervisor.local:443", "", nil, nil)(state(cert)); err != nil {
+		t.Errorf("pinned certificate was rejected after reloading: %v", err)
+	}
+}
+
+func TestVerifyConnectionMismatch(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := selfSigned(t, "supervisor.local")
+	if err := s.Add(Pin{Host: "supervisor.local:443", Fingerprint: Fingerprint(pinned), CA: pinned.Raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &prompter{trusted: true}
+	err = s.VerifyConnection("supervisor.local:443", "", nil, p.prompt)(state(selfSigned(t, "supervisor.local")))
+	if !errors.Is(err, ErrMismatch) {
+		t.Errorf("got %v, want ErrMismatch", err)
+	}
+	if p.asked != 0 {
+		t.Error("asked whether to trust a certificate replacing a pinned one")
+	}
+	if pin, _ := s.Get("supervisor.local:443"); pin.Fingerprint != Fingerprint(pinned) {
+		t.Error("pin was replaced")
+	}
+}
+
+func TestVerifyConnectionDeclined(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := selfSigned(t, "supervisor.local")
+	p := &prompter{trusted: false}
+	verify := s.VerifyConnection("supervisor.local:443", "", nil, p.prompt)
+
+	for i := 0; i < 2; i++ {
+		if err := verify(state(cert)); !errors.Is(err, ErrUntrusted) {
+			t.Errorf("attempt %d: got %v, want ErrUntrusted", i+1, err)
+		}
+	}
+	if p.asked != 1 {
+		t.Errorf("asked %d times, want 1", p.asked)
+	}
+	if _, ok := s.Get("supervisor.local:443"); ok {
+		t.Error("declined certificate was pinned")
+	}
+}
+
+func TestVerifyConnectionVerifiedChain(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := selfSigned(t, "supervisor.local")
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	p := &prompter{trusted: true}
+
+	if err := s.VerifyConnection("10.0.0.1:443", "supervisor.local", roots, p.prompt)(state(cert)); err != nil {
+		t.Fatalf("verified certificate was rejected: %v", err)
+	}
+	if p.asked != 0 {
+		t.Error("asked whether to trust a verified certificate")
+	}
+	if _, ok := s.Get("10.0.0.1:443"); ok {
+		t.Error("verified certificate was pinned")
+	}
+}